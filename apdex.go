@@ -0,0 +1,128 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// DefaultApdexT is the response time which users are satisfied within.
+const DefaultApdexT = 500 * time.Millisecond
+
+// DefaultSLOTargets are the response time targets of the SLO table.
+var DefaultSLOTargets = []time.Duration{10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second}
+
+// Apdex is the Application Performance Index of response times: requests
+// within T satisfy users, the ones within 4T are tolerated and slower or
+// failed requests frustrate them.
+type Apdex struct {
+	t          time.Duration
+	satisfied  int64
+	tolerating int64
+	frustrated int64
+}
+
+func newApdex(t time.Duration, stats *Stats) *Apdex {
+	a := &Apdex{t: t, frustrated: int64(stats.totalFailedReqeusts)}
+	if h := stats.responseTimes; h != nil {
+		a.satisfied = h.CountAtOrBelow(t)
+		a.tolerating = h.CountAtOrBelow(4*t) - a.satisfied
+		a.frustrated += h.TotalCount() - a.satisfied - a.tolerating
+	}
+	return a
+}
+
+// Score is between 0 (all users frustrated) and 1 (all users satisfied).
+func (a *Apdex) Score() float64 {
+	total := a.satisfied + a.tolerating + a.frustrated
+	if total == 0 {
+		return 0
+	}
+	return (float64(a.satisfied) + float64(a.tolerating)/2) / float64(total)
+}
+
+// Rating is the rating of Score by the Apdex specification.
+func (a *Apdex) Rating() string {
+	switch score := a.Score(); {
+	case score >= 0.94:
+		return "Excellent"
+	case score >= 0.85:
+		return "Good"
+	case score >= 0.70:
+		return "Fair"
+	case score >= 0.50:
+		return "Poor"
+	}
+	return "Unacceptable"
+}
+
+// SLOAttainment is the share of requests served within target, failed
+// requests miss any target.
+type SLOAttainment struct {
+	target time.Duration
+	within int64
+	total  int64
+}
+
+func sloAttainments(targets []time.Duration, stats *Stats) []*SLOAttainment {
+	attainments := make([]*SLOAttainment, len(targets))
+	for i, target := range targets {
+		a := &SLOAttainment{target: target, total: int64(stats.totalFailedReqeusts)}
+		if h := stats.responseTimes; h != nil {
+			a.within = h.CountAtOrBelow(target)
+			a.total += h.TotalCount()
+		}
+		attainments[i] = a
+	}
+	return attainments
+}
+
+// Percent is the percentage of requests served within target.
+func (a *SLOAttainment) Percent() float64 {
+	if a.total == 0 {
+		return 0
+	}
+	return float64(a.within) * 100 / float64(a.total)
+}
+
+// parseSLOTargets parses comma separated durations, eg. '100ms,1s'.
+func parseSLOTargets(s string) ([]time.Duration, error) {
+	var targets []time.Duration
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		target, err := time.ParseDuration(item)
+		if err != nil || target <= 0 {
+			return nil, errors.New("invalid SLO target: " + item)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func formatSLOTargets(targets []time.Duration) string {
+	items := make([]string, len(targets))
+	for i, target := range targets {
+		items[i] = target.String()
+	}
+	return strings.Join(items, ",")
+}
+
+func printApdex(buffer *bytes.Buffer, config *Config, stats *Stats) {
+	if config.apdexT > 0 {
+		apdex := newApdex(config.apdexT, stats)
+		fmt.Fprintf(buffer, "Apdex:                  %.3f [T=%s] (%s, satisfied: %d, tolerating: %d, frustrated: %d)\n",
+			apdex.Score(), apdex.t, apdex.Rating(), apdex.satisfied, apdex.tolerating, apdex.frustrated)
+	}
+	if len(config.sloTargets) > 0 {
+		fmt.Fprint(buffer, "Percentage of the requests served within SLO targets (failed requests miss them)\n")
+		for _, a := range sloAttainments(config.sloTargets, stats) {
+			fmt.Fprintf(buffer, " <= %s\t %.2f%% (%d of %d)\n", a.target, a.Percent(), a.within, a.total)
+		}
+	}
+}
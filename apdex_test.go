@@ -0,0 +1,57 @@
+package gb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApdex(t *testing.T) {
+	stats := &Stats{responseTimes: newResponseTimeHistogram(), totalFailedReqeusts: 1}
+	for _, d := range []time.Duration{100, 200, 400, 500, 600, 1500, 2000, 2500, 3000} {
+		stats.responseTimes.Record(d * time.Millisecond)
+	}
+
+	// 4 satisfied, 3 tolerating, 2 slow and 1 failed frustrated
+	apdex := newApdex(500*time.Millisecond, stats)
+	if apdex.satisfied != 4 || apdex.tolerating != 3 || apdex.frustrated != 3 {
+		t.Fatalf("unexpected apdex %+v", apdex)
+	}
+	if apdex.Score() != 0.55 || apdex.Rating() != "Poor" {
+		t.Fatalf("expected a poor score of 0.55, got %.3f (%s)", apdex.Score(), apdex.Rating())
+	}
+
+	if apdex := newApdex(time.Second, &Stats{}); apdex.Score() != 0 {
+		t.Fatalf("expected 0 without requests, got %.3f", apdex.Score())
+	}
+}
+
+func TestSLOAttainments(t *testing.T) {
+	targets, err := parseSLOTargets("100ms, 1s,5s")
+	if err != nil || formatSLOTargets(targets) != "100ms,1s,5s" {
+		t.Fatalf("unexpected targets %v (%v)", targets, err)
+	}
+	if _, err := parseSLOTargets("100ms,-1s"); err == nil {
+		t.Fatal("expected an error of a negative target")
+	}
+
+	stats := &Stats{responseTimes: newResponseTimeHistogram(), totalFailedReqeusts: 1}
+	for i := 1; i <= 9; i++ {
+		stats.responseTimes.Record(time.Duration(i) * 200 * time.Millisecond)
+	}
+	attainments := sloAttainments(targets, stats)
+	for i, expected := range []float64{0, 50, 90} {
+		if attainments[i].Percent() != expected {
+			t.Errorf("expected %.2f%% within %s, got %.2f%%", expected, targets[i], attainments[i].Percent())
+		}
+	}
+
+	var buffer bytes.Buffer
+	printApdex(&buffer, &Config{apdexT: 500 * time.Millisecond, sloTargets: targets}, stats)
+	for _, line := range []string{"Apdex:                  0.550 [T=500ms] (Poor, satisfied: 2, tolerating: 7, frustrated: 1)", " <= 1s\t 50.00% (5 of 10)"} {
+		if !strings.Contains(buffer.String(), line) {
+			t.Errorf("expected %q in the report:\n%s", line, buffer.String())
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package gb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// Authenticator adds credentials to requests. The request given is a copy
+// owned by the authenticator.
+type Authenticator interface {
+	Authenticate(request *http.Request) error
+	String() string
+}
+
+// Challenger is an Authenticator answering authentication challenges. It
+// returns true when the request should be sent again with new credentials.
+type Challenger interface {
+	Challenge(response *http.Response) bool
+}
+
+// authTransport authenticates every request before sending it.
+type authTransport struct {
+	transport *http.Transport
+	auth      Authenticator
+	requests  sync.Map // original request to the authenticated copy
+}
+
+func (t *authTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.send(request)
+	if err != nil {
+		return nil, err
+	}
+
+	challenger, ok := t.auth.(Challenger)
+	if !ok || response.StatusCode != http.StatusUnauthorized || !challenger.Challenge(response) {
+		return response, nil
+	}
+
+	// send again with the answer when the body can be sent again
+	if request.Body != nil && request.Body != http.NoBody {
+		if request.GetBody == nil {
+			return response, nil
+		}
+		body, err := request.GetBody()
+		if err != nil {
+			return response, nil
+		}
+		request = request.Clone(request.Context())
+		request.Body = body
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	return t.send(request)
+}
+
+func (t *authTransport) send(request *http.Request) (*http.Response, error) {
+	authenticated := request.Clone(request.Context())
+	if err := t.auth.Authenticate(authenticated); err != nil {
+		return nil, &AuthError{err}
+	}
+
+	t.requests.Store(request, authenticated)
+	defer t.requests.Delete(request)
+	return t.transport.RoundTrip(authenticated)
+}
+
+func (t *authTransport) CancelRequest(request *http.Request) {
+	if authenticated, ok := t.requests.Load(request); ok {
+		t.transport.CancelRequest(authenticated.(*http.Request))
+	}
+}
+
+// BearerToken sends a fixed token in the Authorization header.
+type BearerToken struct {
+	token  string
+	source string
+}
+
+// NewBearerToken reads the token from a file, or from an environment
+// variable when file is empty.
+func NewBearerToken(file string, env string) (*BearerToken, error) {
+	if file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return newBearerToken(string(content), "file "+file)
+	}
+	return newBearerToken(os.Getenv(env), "$"+env)
+}
+
+func newBearerToken(token string, source string) (*BearerToken, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, errors.New("empty bearer token from " + source)
+	}
+	return &BearerToken{token, source}, nil
+}
+
+func (b *BearerToken) Authenticate(request *http.Request) error {
+	request.Header.Set("Authorization", "Bearer "+b.token)
+	return nil
+}
+
+func (b *BearerToken) String() string {
+	return "bearer token (" + b.source + ")"
+}
+
+// OAuth2RefreshBefore is how long before expiry an OAuth2 token is refreshed.
+// Tokens living shorter than twice of it are refreshed at half of their life.
+const OAuth2RefreshBefore = 30 * time.Second
+
+// OAuth2ClientCredentials fetches access tokens with the client credentials
+// grant of RFC 6749 and refreshes them before they expire.
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	fetched  *sync.Cond
+	fetching bool
+	token    string
+	refresh  time.Time
+	fetches  int32
+}
+
+func NewOAuth2ClientCredentials(config *Config, tokenURL, clientID, clientSecret string, scopes []string) *OAuth2ClientCredentials {
+	o := &OAuth2ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: newClientTLSConfig(config)},
+			Timeout:   MaxExecutionTimeout,
+		},
+		now: time.Now,
+	}
+	o.fetched = sync.NewCond(&o.mu)
+	return o
+}
+
+func (o *OAuth2ClientCredentials) Authenticate(request *http.Request) error {
+	token, err := o.Token()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the current access token. The first one is fetched by the
+// caller while the others wait for it, a token about to expire is refreshed
+// in the background and still returned meanwhile.
+func (o *OAuth2ClientCredentials) Token() (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for o.token == "" && o.fetching {
+		o.fetched.Wait()
+	}
+	if o.token != "" && (o.refresh.IsZero() || o.now().Before(o.refresh)) {
+		return o.token, nil
+	}
+
+	if o.token != "" {
+		if !o.fetching {
+			o.fetching = true
+			go o.refreshToken()
+		}
+		return o.token, nil
+	}
+
+	o.fetching = true
+	o.mu.Unlock()
+	token, refresh, err := o.fetch()
+	o.mu.Lock()
+	o.fetching = false
+	o.fetched.Broadcast()
+	if err != nil {
+		return "", err
+	}
+	o.token, o.refresh = token, refresh
+	return o.token, nil
+}
+
+// refreshToken replaces the token, a failed refresh is tried again a second
+// later while the current token is kept.
+func (o *OAuth2ClientCredentials) refreshToken() {
+	token, refresh, err := o.fetch()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.fetching = false
+	if err != nil {
+		TraceException(err)
+		o.refresh = o.now().Add(time.Second)
+		return
+	}
+	o.token, o.refresh = token, refresh
+}
+
+// fetch fetches a new token and returns it with the time to refresh it,
+// zero when it does not expire.
+func (o *OAuth2ClientCredentials) fetch() (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	request, err := http.NewRequest("POST", o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+
+	fetched := o.now()
+	response, err := o.client.Do(request)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer response.Body.Close()
+	atomic.AddInt32(&o.fetches, 1)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&token); err != nil && response.StatusCode == http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("decode OAuth2 token failed: %s", err)
+	}
+	if response.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("fetch OAuth2 token failed: %s %s", response.Status, token.Error)
+	}
+
+	var refresh time.Time
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		before := OAuth2RefreshBefore
+		if lifetime < 2*before {
+			before = lifetime / 2
+		}
+		refresh = fetched.Add(lifetime - before)
+	}
+	return token.AccessToken, refresh, nil
+}
+
+// prefetchToken fetches the first OAuth2 token before the run, the fetch is
+// not a part of the response time of the first request.
+func prefetchToken(config *Config) {
+	if o, ok := config.auth.(*OAuth2ClientCredentials); ok {
+		if _, err := o.Token(); err != nil {
+			TraceException(err)
+		}
+	}
+}
+
+func (o *OAuth2ClientCredentials) Fetches() int {
+	return int(atomic.LoadInt32(&o.fetches))
+}
+
+func (o *OAuth2ClientCredentials) String() string {
+	return fmt.Sprintf("OAuth2 client credentials (%s, %d token fetches)", o.TokenURL, o.Fetches())
+}
@@ -0,0 +1,276 @@
+package gb
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sendWithAuth sends a request of config through the authenticating client.
+func sendWithAuth(t *testing.T, config *Config) *http.Response {
+	request, err := NewHTTPRequest(config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+	resp, err := NewClient(config).Do(request)
+	if err != nil {
+		t.Fatalf("send http request failed: %s", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func newEchoAuthServer(authorization *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+	}))
+}
+
+func TestBasicAuthWithColonInPassword(t *testing.T) {
+	var authorization string
+	ts := newEchoAuthServer(&authorization)
+	defer ts.Close()
+
+	sendWithAuth(t, &Config{method: "GET", url: ts.URL, basicAuthentication: "gb:pass:word"})
+
+	request, _ := http.NewRequest("GET", ts.URL, nil)
+	request.Header.Set("Authorization", authorization)
+	if username, password, ok := request.BasicAuth(); !ok || username != "gb" || password != "pass:word" {
+		t.Fatalf("unexpected basic authentication %q", authorization)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	var authorization string
+	ts := newEchoAuthServer(&authorization)
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "gbtest")
+	if err != nil {
+		t.Fatalf("create temp file failed: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file-token\n")
+	f.Close()
+
+	auth, err := NewBearerToken(f.Name(), "")
+	if err != nil {
+		t.Fatalf("new bearer token failed: %s", err)
+	}
+	sendWithAuth(t, &Config{method: "GET", url: ts.URL, auth: auth})
+	if authorization != "Bearer file-token" {
+		t.Fatalf("expected token of file, got %q", authorization)
+	}
+
+	os.Setenv("GB_TEST_TOKEN", "env-token")
+	defer os.Unsetenv("GB_TEST_TOKEN")
+	auth, _ = NewBearerToken("", "GB_TEST_TOKEN")
+	sendWithAuth(t, &Config{method: "GET", url: ts.URL, auth: auth})
+	if authorization != "Bearer env-token" {
+		t.Fatalf("expected token of environment, got %q", authorization)
+	}
+
+	if _, err := NewBearerToken("", "GB_TEST_NO_TOKEN"); err == nil {
+		t.Fatal("expected error for empty token")
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var fetches int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "gb" || secret != "secret" || r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "read write" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		n := atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	var authorization string
+	ts := newEchoAuthServer(&authorization)
+	defer ts.Close()
+
+	now := time.Now()
+	auth := NewOAuth2ClientCredentials(&Config{}, tokenServer.URL, "gb", "secret", []string{"read", "write"})
+	auth.now = func() time.Time { return now }
+	config := &Config{method: "GET", url: ts.URL, auth: auth}
+
+	sendWithAuth(t, config)
+	sendWithAuth(t, config)
+	if authorization != "Bearer token-1" || auth.Fetches() != 1 {
+		t.Fatalf("expected cached token-1, got %q after %d fetches", authorization, auth.Fetches())
+	}
+
+	// refreshed in the background before expiry, token-1 is sent meanwhile
+	now = now.Add(time.Hour - OAuth2RefreshBefore)
+	sendWithAuth(t, config)
+	if authorization != "Bearer token-1" {
+		t.Fatalf("expected token-1 during the refresh, got %q", authorization)
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if token, _ := auth.Token(); token == "token-2" {
+			break
+		}
+	}
+	sendWithAuth(t, config)
+	if authorization != "Bearer token-2" || auth.Fetches() != 2 {
+		t.Fatalf("expected refreshed token-2, got %q after %d fetches", authorization, auth.Fetches())
+	}
+
+	invalid := NewOAuth2ClientCredentials(&Config{}, tokenServer.URL, "gb", "wrong", nil)
+	if _, err := invalid.Token(); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Fatalf("expected invalid_client error, got %v", err)
+	}
+}
+
+func TestOAuth2TokenFetchedOnceWithoutBlocking(t *testing.T) {
+	var fetches int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fetches, 1)
+		time.Sleep(100 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	now := time.Now()
+	auth := NewOAuth2ClientCredentials(&Config{}, tokenServer.URL, "gb", "secret", nil)
+	auth.now = func() time.Time { return now }
+
+	// the workers wait for the first token fetched by one of them
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := auth.Token(); err != nil || token != "token-1" {
+				t.Errorf("expected token-1, got %q: %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if auth.Fetches() != 1 {
+		t.Fatalf("expected 1 token fetch, got %d", auth.Fetches())
+	}
+
+	// the refresh doesn't hold up the requests
+	now = now.Add(time.Hour)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if token, err := auth.Token(); err != nil || token != "token-1" {
+			t.Fatalf("expected token-1 during the refresh, got %q: %v", token, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Fatalf("expected the token without waiting for the refresh, took %s", elapsed)
+	}
+	for deadline := time.Now().Add(time.Second); auth.Fetches() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if fetches := atomic.LoadInt32(&fetches); fetches != 2 {
+		t.Fatalf("expected a single refresh, got %d fetches", fetches)
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDigestAuth(t *testing.T) {
+	var challenges, authorized int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := parseAuthParams(strings.TrimPrefix(r.Header.Get("Authorization"), "Digest "))
+		ha1 := md5Hex("gb:gbtest:pass:word")
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		expected := md5Hex(strings.Join([]string{ha1, "nonce-1", params["nc"], params["cnonce"], "auth", ha2}, ":"))
+
+		if params["response"] != expected || params["opaque"] != "opaque-1" || params["uri"] != r.URL.RequestURI() {
+			atomic.AddInt32(&challenges, 1)
+			w.Header().Set("WWW-Authenticate", `Digest realm="gbtest", qop="auth,auth-int", nonce="nonce-1", opaque="opaque-1"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&authorized, 1)
+	}))
+	defer ts.Close()
+
+	auth, err := NewDigestAuth("gb:pass:word")
+	if err != nil {
+		t.Fatalf("new digest auth failed: %s", err)
+	}
+	config := &Config{method: "POST", url: ts.URL + "/upload?id=1", auth: auth, bodyContent: []byte("hello")}
+
+	for i := 0; i < 3; i++ {
+		if resp := sendWithAuth(t, config); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected authorized request, got %s", resp.Status)
+		}
+	}
+	if challenges != 1 || authorized != 3 {
+		t.Fatalf("expected 1 challenge and 3 authorized requests, got %d and %d", challenges, authorized)
+	}
+
+	wrong, _ := NewDigestAuth("gb:wrong")
+	if resp := sendWithAuth(t, &Config{method: "GET", url: ts.URL, auth: wrong}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected rejected credentials, got %s", resp.Status)
+	}
+}
+
+func TestSigV4(t *testing.T) {
+	// get-vanilla of the AWS Signature Version 4 test suite
+	signer := &SigV4{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		Service:   "service",
+		now:       func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+
+	request, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err := signer.Authenticate(request); err != nil {
+		t.Fatalf("sign request failed: %s", err)
+	}
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if actual := request.Header.Get("Authorization"); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+
+	// get-vanilla-query-order-key-case
+	request, _ = http.NewRequest("GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1", nil)
+	signer.Authenticate(request)
+	if !strings.HasSuffix(request.Header.Get("Authorization"), "Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500") {
+		t.Fatalf("unexpected signature %s", request.Header.Get("Authorization"))
+	}
+
+	// streamed bodies are unsigned for S3 only
+	request, _ = http.NewRequest("PUT", "https://bucket.s3.amazonaws.com/key", ioutil.NopCloser(strings.NewReader("hello")))
+	if err := signer.Authenticate(request); err == nil {
+		t.Fatal("expected error for a streamed body")
+	}
+	signer.Service = "s3"
+	if err := signer.Authenticate(request); err != nil || request.Header.Get("X-Amz-Content-Sha256") != sigV4UnsignedPayload {
+		t.Fatalf("expected unsigned payload, got %q (%v)", request.Header.Get("X-Amz-Content-Sha256"), err)
+	}
+}
@@ -1,8 +1,12 @@
 package gb
 
 import (
+	"crypto/tls"
 	"net/http"
 	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type Benchmark struct {
@@ -14,6 +18,18 @@ type Record struct {
 	responseTime time.Duration
 	contentSize  int64
 	Error        error
+	resumed      bool
+	remoteAddr   string
+	proxyConnect time.Duration
+	conn         connUse
+	uploadSize   int64
+	wireSize     int64
+	encodeTime   time.Duration
+	decodeTime   time.Duration
+	statusCode   int
+	redirects    int
+	redirectTime time.Duration
+	queueDelay   time.Duration
 }
 
 const (
@@ -35,7 +51,8 @@ func NewBenchmark(context *Context) *Benchmark {
 
 func (b *Benchmark) Run() {
 
-	jobs := make(chan *http.Request, b.c.config.concurrency*GoMaxProcs)
+	prefetchToken(b.c.config)
+	jobs := make(chan *HTTPJob, b.c.config.concurrency*GoMaxProcs)
 
 	for i := 0; i < b.c.config.concurrency; i++ {
 		go NewHTTPWorker(b.c, jobs, b.Collector).Run(i)
@@ -43,7 +60,7 @@ func (b *Benchmark) Run() {
 
 	base, _ := NewHTTPRequest(b.c.config)
 	for i := 0; i < b.c.config.requests; i++ {
-		jobs <- CopyHTTPRequest(b.c.config, base)
+		jobs <- NewHTTPJob(CopyHTTPRequest(b.c.config, base))
 	}
 	close(jobs)
 
@@ -61,7 +78,9 @@ func (b *Benchmark) RunCustom(custom CustomRequest) {
 	}
 
 	//	jobs := make(chan *http.Request, b.c.config.concurrency*GoMaxProcs)
-	jobs := make(chan *http.Request, reqscount)
+	jobs := make(chan *HTTPJob, reqscount)
+
+	prefetchToken(b.c.config)
 
 	for i := 0; i < b.c.config.concurrency; i++ {
 		h := NewHTTPWorker(b.c, jobs, b.Collector)
@@ -79,10 +98,104 @@ func (b *Benchmark) RunCustom(custom CustomRequest) {
 	for i := 0; i < reqscount; i++ {
 		if custom != nil {
 			rq, _ := custom.Prepare(b.c.config, base, i)
-			jobs <- rq
+			jobs <- NewHTTPJob(rq)
 		} else {
-			jobs <- CopyHTTPRequest(b.c.config, base)
+			jobs <- NewHTTPJob(CopyHTTPRequest(b.c.config, base))
+		}
+	}
+	close(jobs)
+	b.c.start.Done()
+
+	<-b.c.stop
+}
+
+func (b *Benchmark) RunGRPC() {
+
+	var reqscount int
+	if b.c.config.skipFirst {
+		reqscount = b.c.config.requests + b.c.config.concurrency
+	} else {
+		reqscount = b.c.config.requests
+	}
+
+	jobs := make(chan proto.Message, reqscount)
+
+	method := b.c.GetValue(FieldGRPCMethod).(protoreflect.MethodDescriptor)
+	requests := b.c.GetValue(FieldGRPCRequests).(*GRPCRequestTemplate)
+
+	for i := 0; i < b.c.config.concurrency; i++ {
+		go NewGRPCWorker(b.c, method, jobs, b.Collector).Run(i)
+	}
+
+	for i := 0; i < reqscount; i++ {
+		rq, err := requests.Message(i)
+		if err != nil {
+			TraceException(err)
+			b.Collector <- &Record{Error: &ExceptionError{err}}
+			continue
 		}
+		jobs <- rq
+	}
+	close(jobs)
+	b.c.start.Done()
+
+	<-b.c.stop
+}
+
+func (b *Benchmark) RunRaw() {
+
+	var reqscount int
+	if b.c.config.skipFirst {
+		reqscount = b.c.config.requests + b.c.config.concurrency
+	} else {
+		reqscount = b.c.config.requests
+	}
+
+	jobs := make(chan struct{}, reqscount)
+
+	request, err := NewRawHTTPRequest(b.c.config)
+
+	for i := 0; i < b.c.config.concurrency; i++ {
+		go NewRawHTTPWorker(b.c, request, jobs, b.Collector).Run(i)
+	}
+
+	// the workers have nothing to send without a request, every one of the
+	// requests fails instead
+	for i := 0; i < reqscount && err == nil; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	b.c.start.Done()
+
+	if err != nil {
+		TraceException(err)
+		for i := 0; i < b.c.config.requests; i++ {
+			b.Collector <- &Record{Error: &ExceptionError{err}}
+		}
+	}
+
+	<-b.c.stop
+}
+
+func (b *Benchmark) RunHandshake() {
+
+	var reqscount int
+	if b.c.config.skipFirst {
+		reqscount = b.c.config.requests + b.c.config.concurrency
+	} else {
+		reqscount = b.c.config.requests
+	}
+
+	jobs := make(chan struct{}, reqscount)
+
+	shared := tls.NewLRUClientSessionCache(b.c.config.concurrency)
+	for i := 0; i < b.c.config.concurrency; i++ {
+		cache := NewSessionCache(b.c.config.tlsResume, shared)
+		go NewHandshakeWorker(b.c, cache, jobs, b.Collector).Run(i)
+	}
+
+	for i := 0; i < reqscount; i++ {
+		jobs <- struct{}{}
 	}
 	close(jobs)
 	b.c.start.Done()
@@ -0,0 +1,207 @@
+package gb
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	FillRandom = "random"
+
+	bodyBlockSize = 64 * 1024
+)
+
+// Body generates request bodies without holding them in memory. The content
+// is either streamed from a file or a repeated block of random or fixed bytes.
+type Body struct {
+	File    string
+	Size    int64
+	Fill    string
+	Chunked bool
+
+	block []byte
+}
+
+// NewBody returns a body of size bytes filled by fill, which is 'random' or a
+// single byte given as a character or in hex, eg. 'a' or '0x00'. The size is
+// taken from the file when file is given.
+func NewBody(file string, size int64, fill string, chunked bool) (*Body, error) {
+	b := &Body{File: file, Size: size, Fill: fill, Chunked: chunked}
+
+	if file != "" {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, errors.New("body file is a directory: " + file)
+		}
+		b.Size = info.Size()
+		return b, nil
+	}
+
+	if size < 0 {
+		return nil, errors.New("body size must not be negative")
+	}
+
+	b.block = make([]byte, bodyBlockSize)
+	if fill == FillRandom {
+		if _, err := rand.Read(b.block); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	c, err := parseFillByte(fill)
+	if err != nil {
+		return nil, err
+	}
+	for i := range b.block {
+		b.block[i] = c
+	}
+	return b, nil
+}
+
+func parseFillByte(fill string) (byte, error) {
+	if len(fill) == 1 {
+		return fill[0], nil
+	}
+	if strings.HasPrefix(fill, "0x") {
+		if c, err := strconv.ParseUint(fill[2:], 16, 8); err == nil {
+			return byte(c), nil
+		}
+	}
+	return 0, errors.New("body fill must be 'random', a character or a hex byte, eg. '0x00': " + fill)
+}
+
+// NewReader returns the content of a request and its length, which is -1 for
+// chunked transfer encoding.
+func (b *Body) NewReader() (io.ReadCloser, int64) {
+	length := b.Size
+	if b.Chunked {
+		length = -1
+	}
+
+	if b.File != "" {
+		return &fileReader{name: b.File}, length
+	}
+
+	return &repeatReader{block: b.block, remaining: b.Size}, length
+}
+
+func (b *Body) String() string {
+	var s string
+	if b.File != "" {
+		s = fmt.Sprintf("%s (%d bytes)", b.File, b.Size)
+	} else {
+		s = fmt.Sprintf("%s (%d bytes)", b.Fill, b.Size)
+	}
+	if b.Chunked {
+		s += ", chunked"
+	}
+	return s
+}
+
+// repeatReader reads the block over and over until remaining bytes are read.
+type repeatReader struct {
+	block     []byte
+	offset    int
+	remaining int64
+}
+
+func (r *repeatReader) Read(p []byte) (n int, err error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	for n < len(p) {
+		copied := copy(p[n:], r.block[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.block)
+	}
+	r.remaining -= int64(n)
+	return
+}
+
+func (r *repeatReader) Close() error {
+	return nil
+}
+
+// fileReader opens the file on the first read, so requests queued up front do
+// not hold file descriptors.
+type fileReader struct {
+	name string
+	f    *os.File
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.f == nil {
+		f, err := os.Open(r.name)
+		if err != nil {
+			return 0, err
+		}
+		r.f = f
+	}
+	return r.f.Read(p)
+}
+
+func (r *fileReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// countingReader counts the bytes of request body sent.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return
+}
+
+func (c *countingReader) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// ParseByteSize parses a size with an optional unit of K, M or G in powers
+// of 1024, eg. '512', '64K' or '1.5GB'.
+func ParseByteSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	s = strings.TrimSuffix(s, "I")
+
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size: " + size)
+	}
+	return int64(n * float64(multiplier)), nil
+}
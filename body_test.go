@@ -0,0 +1,131 @@
+package gb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	testData := map[string]int64{
+		"0":     0,
+		"512":   512,
+		"64K":   64 << 10,
+		"64kb":  64 << 10,
+		"10MiB": 10 << 20,
+		"1.5G":  3 << 29,
+	}
+
+	for testingData, expectedData := range testData {
+		if size, err := ParseByteSize(testingData); err != nil || size != expectedData {
+			t.Errorf("parse %s expected %d, got %d (%v)", testingData, expectedData, size, err)
+		}
+	}
+
+	for _, size := range []string{"", "K", "-1", "10T"} {
+		if _, err := ParseByteSize(size); err == nil {
+			t.Errorf("expected error for %q", size)
+		}
+	}
+}
+
+func TestNewBody(t *testing.T) {
+	body, err := NewBody("", bodyBlockSize*2+10, "0x61", false)
+	if err != nil {
+		t.Fatalf("new body failed: %s", err)
+	}
+
+	reader, length := body.NewReader()
+	content, _ := ioutil.ReadAll(reader)
+	if length != bodyBlockSize*2+10 || !bytes.Equal(content, bytes.Repeat([]byte("a"), bodyBlockSize*2+10)) {
+		t.Fatalf("expected %d bytes of 'a', got %d bytes", bodyBlockSize*2+10, len(content))
+	}
+
+	random, _ := NewBody("", 100, FillRandom, true)
+	if _, length := random.NewReader(); length != -1 {
+		t.Fatalf("expected unknown length of chunked body, got %d", length)
+	}
+
+	for _, fill := range []string{"ab", "0xzz", ""} {
+		if _, err := NewBody("", 1, fill, false); err == nil {
+			t.Errorf("expected error for fill %q", fill)
+		}
+	}
+}
+
+func sendBody(t *testing.T, config *Config) (received *http.Request, content []byte, record *Record) {
+	requests := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ = ioutil.ReadAll(r.Body)
+		requests <- r
+	}))
+	defer ts.Close()
+
+	config.concurrency = 1
+	config.requests = 1
+	config.method = "POST"
+	config.executionTimeout = MaxExecutionTimeout
+	config.url = ts.URL
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 0)
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	base, err := NewHTTPRequest(config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+	jobs <- NewHTTPJob(CopyHTTPRequest(config, base))
+	record = <-collector
+	close(jobs)
+	close(context.stop)
+
+	if record.Error != nil {
+		t.Fatalf("send http request failed: %s", record.Error)
+	}
+	return <-requests, content, record
+}
+
+func TestHTTPWorkerWithChunkedBody(t *testing.T) {
+	body, _ := NewBody("", 100000, FillRandom, true)
+	request, content, record := sendBody(t, &Config{body: body})
+
+	if len(request.TransferEncoding) == 0 || request.TransferEncoding[0] != "chunked" {
+		t.Fatalf("expected chunked transfer encoding, got %v", request.TransferEncoding)
+	}
+	if len(content) != 100000 || record.uploadSize != 100000 {
+		t.Fatalf("expected 100000 bytes sent, got %d (recorded %d)", len(content), record.uploadSize)
+	}
+}
+
+func TestHTTPWorkerWithBodyFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "gbtest")
+	if err != nil {
+		t.Fatalf("create temp file failed: %s", err)
+	}
+	defer os.Remove(f.Name())
+	io.CopyN(f, &repeatReader{block: []byte("0123456789"), remaining: 12345}, 12345)
+	f.Close()
+
+	body, err := NewBody(f.Name(), 0, "", false)
+	if err != nil {
+		t.Fatalf("new body failed: %s", err)
+	}
+	request, content, record := sendBody(t, &Config{body: body})
+
+	if request.ContentLength != 12345 || len(content) != 12345 || record.uploadSize != 12345 {
+		t.Fatalf("expected 12345 bytes sent, got %d of %d (recorded %d)", len(content), request.ContentLength, record.uploadSize)
+	}
+	if !bytes.HasPrefix(content, []byte("01234567890123")) {
+		t.Fatalf("unexpected content %q", content[:14])
+	}
+}
@@ -24,9 +24,11 @@ func (s *StopWatch) Stop() {
 var errorCount map[string]int
 var cancelCnt int = 0
 
-func ReportAll() {
+// ReportAll prints the count of every traced error to the progress output of
+// config.
+func ReportAll(config *Config) {
 	for key, value := range errorCount {
-		fmt.Println("count:[", value, "]:", key)
+		fmt.Fprintln(config.progressOutput(), "count:[", value, "]:", key)
 	}
 }
 
@@ -0,0 +1,258 @@
+package gb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-errors/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+)
+
+func validateEncoding(encoding string) error {
+	switch encoding {
+	case EncodingGzip, EncodingBrotli, EncodingZstd:
+		return nil
+	}
+	return errors.New("unsupported content encoding: " + encoding)
+}
+
+// parseEncodings parses a comma separated list of content encodings.
+func parseEncodings(list string) (encodings []string, err error) {
+	for _, encoding := range strings.Split(list, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" {
+			continue
+		}
+		if err = validateEncoding(encoding); err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, encoding)
+	}
+	if len(encodings) == 0 {
+		return nil, errors.New("no content encoding given")
+	}
+	return
+}
+
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingBrotli:
+		return brotli.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, validateEncoding(encoding)
+}
+
+// compressBytes encodes content with the content encoding.
+func compressBytes(encoding string, content []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder, err := newEncoder(encoding, &buffer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = encoder.Write(content); err != nil {
+		return nil, err
+	}
+	if err = encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// encodeTimer is a request body knowing the time spent encoding it.
+type encodeTimer interface {
+	encodeTime() time.Duration
+}
+
+// encodedBody is a request body encoded in advance in time.
+type encodedBody struct {
+	io.ReadCloser
+	time time.Duration
+}
+
+func (b *encodedBody) encodeTime() time.Duration {
+	return b.time
+}
+
+// timedReader and timedWriter add the time spent in reads and writes to
+// wait, which is taken off the time of encoding and decoding.
+type timedReader struct {
+	r    io.Reader
+	wait *time.Duration
+}
+
+func (t timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	*t.wait += time.Since(start)
+	return n, err
+}
+
+type timedWriter struct {
+	w    io.Writer
+	wait *time.Duration
+}
+
+func (t timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	*t.wait += time.Since(start)
+	return n, err
+}
+
+// compressReader encodes a streamed body while it is sent, the length of the
+// result is unknown in advance.
+func compressReader(encoding string, body io.ReadCloser) io.ReadCloser {
+	return &compressingReader{encoding: encoding, body: body}
+}
+
+// compressingReader starts the encoder on the first read, so requests queued
+// up front do not hold goroutines, encoders or opened bodies.
+type compressingReader struct {
+	encoding string
+	body     io.ReadCloser
+	pr       *io.PipeReader
+	time     int64 // nanoseconds of encoding, set when the encoder is done
+}
+
+func (r *compressingReader) Read(p []byte) (int, error) {
+	if r.pr == nil {
+		r.start()
+	}
+	return r.pr.Read(p)
+}
+
+func (r *compressingReader) start() {
+	pr, pw := io.Pipe()
+	r.pr = pr
+	go func() {
+		defer r.body.Close()
+
+		// the encoder waits for the body to be generated and sent
+		var wait time.Duration
+		start := time.Now()
+		encoder, err := newEncoder(r.encoding, timedWriter{pw, &wait})
+		if err == nil {
+			if _, err = io.Copy(encoder, timedReader{r.body, &wait}); err == nil {
+				err = encoder.Close()
+			}
+		}
+		atomic.StoreInt64(&r.time, int64(time.Since(start)-wait))
+		pw.CloseWithError(err)
+	}()
+}
+
+func (r *compressingReader) encodeTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.time))
+}
+
+// Close stops the encoder, which closes the body, or closes the body if it is
+// not read yet.
+func (r *compressingReader) Close() error {
+	if r.pr == nil {
+		return r.body.Close()
+	}
+	return r.pr.Close()
+}
+
+// decoderPool keeps decoders for reuse between responses.
+var decoderPool = sync.Pool{New: func() interface{} { return &decoders{} }}
+
+type decoders struct {
+	gzip   *gzip.Reader
+	brotli *brotli.Reader
+	zstd   *zstd.Decoder
+}
+
+// hasContent reports whether resp may carry an encoded body, responses to
+// HEAD requests, 204, 304 and empty ones have nothing to decode.
+func hasContent(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	return resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified && resp.ContentLength != 0
+}
+
+// decodeLazily returns body decoded on the first read like net/http does for
+// gzip, so an empty body reads as EOF instead of failing on a missing header.
+func (d *decoders) decodeLazily(encoding string, body io.Reader) *lazyDecoder {
+	r := &lazyDecoder{d: d, encoding: encoding}
+	r.body = timedReader{body, &r.wait}
+	return r
+}
+
+type lazyDecoder struct {
+	d        *decoders
+	encoding string
+	body     io.Reader
+	decoded  io.Reader
+	err      error
+
+	spent time.Duration // in reads
+	wait  time.Duration // for the body in reads
+}
+
+func (r *lazyDecoder) Read(p []byte) (int, error) {
+	start := time.Now()
+	defer func() {
+		r.spent += time.Since(start)
+	}()
+
+	if r.decoded == nil && r.err == nil {
+		r.decoded, r.err = r.d.decode(r.encoding, r.body)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.decoded.Read(p)
+}
+
+// decodeTime is the time spent decoding, without waiting for the body.
+func (r *lazyDecoder) decodeTime() time.Duration {
+	return r.spent - r.wait
+}
+
+// decode returns the decoded body of the content encoding, or body itself for
+// the identity and unknown encodings.
+func (d *decoders) decode(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case EncodingGzip:
+		if d.gzip == nil {
+			var err error
+			d.gzip, err = gzip.NewReader(body)
+			return d.gzip, err
+		}
+		return d.gzip, d.gzip.Reset(body)
+	case EncodingBrotli:
+		if d.brotli == nil {
+			d.brotli = brotli.NewReader(body)
+			return d.brotli, nil
+		}
+		return d.brotli, d.brotli.Reset(body)
+	case EncodingZstd:
+		if d.zstd == nil {
+			var err error
+			if d.zstd, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1)); err != nil {
+				return nil, err
+			}
+		}
+		return d.zstd, d.zstd.Reset(body)
+	}
+	return body, nil
+}
@@ -0,0 +1,204 @@
+package gb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseEncodings(t *testing.T) {
+	encodings, err := parseEncodings("gzip, BR,zstd")
+	if err != nil || strings.Join(encodings, " ") != "gzip br zstd" {
+		t.Fatalf("unexpected encodings %v (%v)", encodings, err)
+	}
+
+	for _, list := range []string{"", "deflate", "gzip,lz4"} {
+		if _, err := parseEncodings(list); err == nil {
+			t.Errorf("expected error for %q", list)
+		}
+	}
+}
+
+func TestCompressAndDecode(t *testing.T) {
+	content := bytes.Repeat([]byte("GoHttpBench "), 1000)
+	d := &decoders{}
+
+	for _, encoding := range []string{EncodingGzip, EncodingBrotli, EncodingZstd} {
+		// twice to reuse the decoder
+		for i := 0; i < 2; i++ {
+			compressed, err := compressBytes(encoding, content)
+			if err != nil {
+				t.Fatalf("compress %s failed: %s", encoding, err)
+			}
+			if len(compressed) >= len(content) {
+				t.Errorf("expected %s to compress, got %d bytes", encoding, len(compressed))
+			}
+
+			reader, err := d.decode(encoding, bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("decode %s failed: %s", encoding, err)
+			}
+			if decoded, _ := ioutil.ReadAll(reader); !bytes.Equal(decoded, content) {
+				t.Fatalf("decode %s mismatch", encoding)
+			}
+		}
+
+		streamed, _ := ioutil.ReadAll(compressReader(encoding, ioutil.NopCloser(bytes.NewReader(content))))
+		reader, _ := d.decode(encoding, bytes.NewReader(streamed))
+		if decoded, _ := ioutil.ReadAll(reader); !bytes.Equal(decoded, content) {
+			t.Fatalf("decode streamed %s mismatch", encoding)
+		}
+	}
+}
+
+func TestHTTPWorkerWithCompression(t *testing.T) {
+	content := bytes.Repeat([]byte("GoHttpBench "), 1000)
+	var received []byte
+	var requestEncoding, acceptEncoding string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestEncoding = r.Header.Get("Content-Encoding")
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		reader, _ := (&decoders{}).decode(requestEncoding, r.Body)
+		received, _ = ioutil.ReadAll(reader)
+
+		compressed, _ := compressBytes(EncodingZstd, content)
+		w.Header().Set("Content-Encoding", EncodingZstd)
+		w.Write(compressed)
+	}))
+	defer ts.Close()
+
+	body, _ := NewBody("", 5000, "a", false)
+	config := &Config{
+		concurrency:      1,
+		requests:         1,
+		method:           "POST",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		gzip:             true,
+		acceptEncodings:  []string{EncodingBrotli, EncodingZstd},
+		body:             body,
+		bodyEncoding:     EncodingBrotli,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(content))
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	request, _ := NewHTTPRequest(config)
+	jobs <- NewHTTPJob(request)
+	record := <-collector
+	close(jobs)
+	close(context.stop)
+
+	if record.Error != nil {
+		t.Fatalf("send http request failed: %s", record.Error)
+	}
+	if requestEncoding != "br" || acceptEncoding != "br, zstd" || !bytes.Equal(received, bytes.Repeat([]byte("a"), 5000)) {
+		t.Fatalf("unexpected request %q %q of %d bytes", requestEncoding, acceptEncoding, len(received))
+	}
+	if record.uploadSize <= 0 || record.uploadSize >= 5000 {
+		t.Fatalf("expected compressed upload, got %d bytes", record.uploadSize)
+	}
+	if record.contentSize != int64(len(content)) || record.wireSize <= 0 || record.wireSize >= record.contentSize {
+		t.Fatalf("expected %d decoded bytes over less wire bytes, got %d and %d", len(content), record.contentSize, record.wireSize)
+	}
+	if record.encodeTime <= 0 || record.decodeTime <= 0 {
+		t.Fatalf("expected the time of encoding and decoding, got %s and %s", record.encodeTime, record.decodeTime)
+	}
+}
+
+func TestCompressReaderIsLazy(t *testing.T) {
+	body, err := NewBody("testdata/postfile.txt", 0, "", false)
+	if err != nil {
+		t.Fatalf("create body failed: %s", err)
+	}
+	config := &Config{body: body, bodyEncoding: EncodingGzip}
+
+	goroutines := runtime.NumGoroutine()
+	var readers []io.ReadCloser
+	for i := 0; i < 100; i++ {
+		reader, length := newGeneratedBody(config)
+		if length != -1 {
+			t.Fatalf("expected unknown length of compressed body, got %d", length)
+		}
+		readers = append(readers, reader)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Fatalf("expected no encoder goroutines before reading, got %d more", n-goroutines)
+	}
+	for _, reader := range readers {
+		r := reader.(*compressingReader)
+		if r.pr != nil || r.body.(*fileReader).f != nil {
+			t.Fatal("expected no file or encoder opened before reading")
+		}
+	}
+
+	compressed, _ := ioutil.ReadAll(readers[0])
+	decoded, _ := (&decoders{}).decode(EncodingGzip, bytes.NewReader(compressed))
+	expected, _ := ioutil.ReadFile("testdata/postfile.txt")
+	if content, _ := ioutil.ReadAll(decoded); !bytes.Equal(content, expected) {
+		t.Fatalf("expected the file content, got %q", content)
+	}
+	for _, reader := range readers {
+		if err := reader.Close(); err != nil {
+			t.Fatalf("close body failed: %s", err)
+		}
+	}
+}
+
+func TestHTTPWorkerWithEncodedEmptyResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", EncodingGzip)
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", "100")
+			return
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer ts.Close()
+
+	successCodes, _ := ParseStatusCodes("2xx,304")
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		config := &Config{
+			concurrency:      1,
+			requests:         1,
+			method:           method,
+			executionTimeout: MaxExecutionTimeout,
+			url:              ts.URL,
+			successCodes:     successCodes,
+		}
+
+		context := NewContext(config)
+		if err := DetectHost(context); err != nil {
+			t.Fatalf("detect host with %s failed: %s", method, err)
+		}
+		context.SetInt(FieldContentSize, 5)
+		jobs := make(chan *HTTPJob)
+		collector := make(chan *Record)
+
+		worker := NewHTTPWorker(context, jobs, collector)
+		context.startRun.Done()
+		go worker.Run(0)
+
+		request, _ := NewHTTPRequest(config)
+		jobs <- NewHTTPJob(request)
+		record := <-collector
+		close(jobs)
+		close(context.stop)
+
+		if record.Error != nil {
+			t.Fatalf("expected no error of an empty gzip response to %s, got %s", method, record.Error)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package gb
 
 import (
 	"net/url"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -20,10 +22,99 @@ func TestExtractHostAndPort(t *testing.T) {
 
 	for testingData, expectedData := range testData {
 		URL, _ := url.Parse(testingData)
-		host, port := extractHostAndPort(URL)
+		host, port, err := extractHostAndPort(URL)
 
-		if host != expectedData.host && port != expectedData.port {
+		if err != nil || host != expectedData.host && port != expectedData.port {
 			t.Errorf("expected host:%s and port:%d, got", host, port)
 		}
 	}
+
+	URL, _ := url.Parse("ftp://localhost/")
+	if _, _, err := extractHostAndPort(URL); err == nil {
+		t.Error("expected error for unsupported protocol schema")
+	}
+}
+
+func TestParseUnixSocketURL(t *testing.T) {
+
+	type Pair struct {
+		socket string
+		path   string
+	}
+
+	testData := map[string]Pair{
+		"unix:///var/run/app.sock:/api/x": Pair{"/var/run/app.sock", "/api/x"},
+		"unix:///var/run/app.sock:api":    Pair{"/var/run/app.sock", "/api"},
+		"unix:///var/run/app.sock":        Pair{"/var/run/app.sock", "/"},
+	}
+
+	for testingData, expectedData := range testData {
+		socket, path, err := parseUnixSocketURL(testingData)
+
+		if err != nil || socket != expectedData.socket || path != expectedData.path {
+			t.Errorf("expected socket:%s and path:%s, got socket:%s and path:%s", expectedData.socket, expectedData.path, socket, path)
+		}
+	}
+
+	if _, _, err := parseUnixSocketURL("unix://:/api"); err == nil {
+		t.Error("expected error for missing socket path")
+	}
+}
+
+// loadConfig runs LoadConfig with the command line args.
+func loadConfig(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	saved := os.Args
+	defer func() { os.Args = saved }()
+	os.Args = append([]string{"gb"}, args...)
+	return LoadConfig()
+}
+
+func TestLoadConfigPoolOptions(t *testing.T) {
+	if _, err := loadConfig(t, "-pool", "shared", "-max-conns", "2", "http://localhost/"); err != nil {
+		t.Fatalf("expected pool options of the http engine, got %s", err)
+	}
+
+	for _, args := range [][]string{
+		{"-raw", "-pool", "shared", "http://localhost/"},
+		{"-raw", "-max-conns", "2", "http://localhost/"},
+		{"-raw", "-idle-timeout", "1s", "http://localhost/"},
+		{"-grpc", "pkg.Service/Method", "-conn-requests", "10", "grpc://localhost:50051"},
+	} {
+		if _, err := loadConfig(t, args...); err == nil || !strings.Contains(err.Error(), "connection pool options") {
+			t.Errorf("expected an error of pool options with %v, got %v", args, err)
+		}
+	}
+
+	if _, err := loadConfig(t, "-pool", "shared", "-conn-requests", "10", "http://localhost/"); err == nil || !strings.Contains(err.Error(), "-conn-requests") {
+		t.Errorf("expected an error of -conn-requests with a shared pool, got %v", err)
+	}
+}
+
+func TestLoadConfigFormConflicts(t *testing.T) {
+	if _, err := loadConfig(t, "-F", "name=value", "http://localhost/"); err != nil {
+		t.Fatalf("expected a form, got %s", err)
+	}
+
+	for _, args := range [][]string{
+		{"-F", "name=value", "-p", "testdata/postfile.txt", "http://localhost/"},
+		{"-F", "name=value", "-u", "testdata/postfile.txt", "http://localhost/"},
+		{"-F", "name=value", "-body-size", "1KB", "http://localhost/"},
+		{"-F", "name=value", "-T", "application/json", "http://localhost/"},
+	} {
+		if _, err := loadConfig(t, args...); err == nil || !strings.Contains(err.Error(), "-F") {
+			t.Errorf("expected an error of -F with %v, got %v", args, err)
+		}
+	}
+}
+
+func TestLoadConfigScrapeSeries(t *testing.T) {
+	config, err := loadConfig(t, "-scrape", "http://localhost:9090/metrics", "-scrape-series", `rate(http_requests_total{code="500"}),memstats.HeapAlloc`, "http://localhost/")
+	if err != nil || len(config.scraper.Series) != 2 {
+		t.Fatalf("expected 2 series, got %v (%v)", config, err)
+	}
+
+	if _, err := loadConfig(t, "-scrape", "http://localhost:9090/metrics", "-scrape-series", "queue_depth{queue=jobs}", "http://localhost/"); err == nil || !strings.Contains(err.Error(), "invalid series") {
+		t.Fatalf("expected an error of an invalid series, got %v", err)
+	}
 }
@@ -2,6 +2,7 @@ package gb
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 type Context struct {
@@ -11,6 +12,7 @@ type Context struct {
 	stop     chan struct{}
 	rwm      *sync.RWMutex
 	store    map[string]interface{}
+	inFlight atomic.Int64
 }
 
 func NewContext(config *Config) *Context {
@@ -18,7 +20,20 @@ func NewContext(config *Config) *Context {
 	start.Add(config.concurrency + 1)
 	startRun := &sync.WaitGroup{}
 	startRun.Add(1)
-	return &Context{config, start, startRun, make(chan struct{}), &sync.RWMutex{}, make(map[string]interface{})}
+	return &Context{config, start, startRun, make(chan struct{}), &sync.RWMutex{}, make(map[string]interface{}), atomic.Int64{}}
+}
+
+// BeginRequest and EndRequest count the requests in flight of workers.
+func (c *Context) BeginRequest() {
+	c.inFlight.Add(1)
+}
+
+func (c *Context) EndRequest() {
+	c.inFlight.Add(-1)
+}
+
+func (c *Context) InFlight() int64 {
+	return c.inFlight.Load()
 }
 
 func (c *Context) SetString(key string, value string) {
@@ -44,3 +59,15 @@ func (c *Context) GetInt(key string) int {
 	defer c.rwm.RUnlock()
 	return c.store[key].(int)
 }
+
+func (c *Context) SetValue(key string, value interface{}) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+	c.store[key] = value
+}
+
+func (c *Context) GetValue(key string) interface{} {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+	return c.store[key]
+}
@@ -29,3 +29,20 @@ func TestSetAndGetInt(t *testing.T) {
 		t.Fatalf("expected %d, got %d", value, got)
 	}
 }
+
+func TestSetAndGetValue(t *testing.T) {
+	key := "key"
+	value := []int{1, 2, 3}
+
+	context := NewContext(&Config{})
+	context.SetValue(key, value)
+
+	got, ok := context.GetValue(key).([]int)
+	if !ok || len(got) != len(value) || got[0] != value[0] {
+		t.Fatalf("expected %v, got %v", value, got)
+	}
+
+	if context.GetValue("missing") != nil {
+		t.Fatal("expected nil for missing key")
+	}
+}
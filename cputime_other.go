@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package gb
+
+import (
+	"time"
+)
+
+// processCPUTime is not available on this platform.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package gb
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and kernel CPU time used by the process.
+func processCPUTime() (time.Duration, bool) {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, false
+	}
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return 0, false
+	}
+	// filetimes count 100ns intervals
+	ticks := func(f syscall.Filetime) int64 { return int64(f.HighDateTime)<<32 | int64(f.LowDateTime) }
+	return time.Duration(ticks(kernel)+ticks(user)) * 100, true
+}
@@ -0,0 +1,175 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DashboardRefresh is how often the dashboard is drawn.
+	DashboardRefresh = time.Second
+	// DashboardHistory is the number of refreshes shown by the sparkline.
+	DashboardHistory = 60
+
+	ansiClear = "\033[H\033[2J"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// isTerminal reports whether f is a character device, eg. not a pipe or a
+// file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ConnCounter counts the connections dialed and the ones still open.
+type ConnCounter struct {
+	opened atomic.Int64
+	open   atomic.Int64
+}
+
+func (c *ConnCounter) wrap(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c.opened.Add(1)
+		c.open.Add(1)
+		return &countedConn{Conn: conn, counter: c}, nil
+	}
+}
+
+func (c *ConnCounter) Opened() int64 {
+	return c.opened.Load()
+}
+
+func (c *ConnCounter) Open() int64 {
+	return c.open.Load()
+}
+
+type countedConn struct {
+	net.Conn
+	counter *ConnCounter
+	closed  atomic.Bool
+}
+
+func (c *countedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.counter.open.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// Dashboard draws the progress of the run in the terminal, it is fed with the
+// records and statistics of the Monitor loop.
+type Dashboard struct {
+	c       *Context
+	out     io.Writer
+	start   time.Time
+	current *intervalRecorder
+	history []*IntervalStats
+}
+
+func NewDashboard(context *Context, out io.Writer, start time.Time) *Dashboard {
+	return &Dashboard{c: context, out: out, start: start, current: newIntervalRecorder(start)}
+}
+
+func (d *Dashboard) record(record *Record) {
+	d.current.record(record)
+}
+
+// Refresh ends the current refresh interval at now and draws the dashboard.
+func (d *Dashboard) Refresh(now time.Time, stats *Stats) {
+	d.history = append(d.history, d.current.flush(now, d.c.InFlight()))
+	if len(d.history) > DashboardHistory {
+		d.history = d.history[1:]
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(ansiClear)
+	d.render(&buffer, now, stats)
+	d.out.Write(buffer.Bytes())
+}
+
+func (d *Dashboard) render(buffer *bytes.Buffer, now time.Time, stats *Stats) {
+	config := d.c.config
+	elapsed := now.Sub(d.start)
+	current := d.history[len(d.history)-1]
+	average := float64(stats.totalRequests) / elapsed.Seconds()
+
+	fmt.Fprintf(buffer, "gb %s\n\n", config.url)
+	fmt.Fprintf(buffer, "Elapsed:      %s\n", elapsed.Truncate(time.Second))
+	if config.timelimit > 0 {
+		remaining := time.Duration(config.timelimit)*time.Second - elapsed
+		fmt.Fprintf(buffer, "Remaining:    %s\n", max(remaining, 0).Truncate(time.Second))
+	} else if average > 0 {
+		remaining := time.Duration(float64(config.requests-stats.totalRequests) / average * float64(time.Second))
+		fmt.Fprintf(buffer, "Remaining:    %s (%d of %d requests)\n", remaining.Truncate(time.Second), stats.totalRequests, config.requests)
+	}
+	fmt.Fprintf(buffer, "Requests:     %d (success %d, failed %d)\n", stats.totalRequests, stats.totalSuccess, stats.totalFailedReqeusts)
+	fmt.Fprintf(buffer, "RPS:          %.2f current, %.2f average\n", current.RPS(), average)
+	fmt.Fprintf(buffer, "In flight:    %d\n", current.inFlight)
+	if config.conns != nil {
+		fmt.Fprintf(buffer, "Connections:  %d active, %d opened\n", config.conns.Open(), config.conns.Opened())
+	}
+	fmt.Fprint(buffer, "\n")
+
+	unit := config.timeUnit.resolve(stats.responseTimes)
+	if responseTimes := stats.responseTimes; responseTimes != nil && responseTimes.TotalCount() > 0 {
+		fmt.Fprintf(buffer, "Latency (%s): p50 %s  p90 %s  p99 %s  p99.9 %s  max %s\n", unit,
+			unit.Format(responseTimes.Percentile(50)), unit.Format(responseTimes.Percentile(90)), unit.Format(responseTimes.Percentile(99)),
+			unit.Format(responseTimes.Percentile(99.9)), unit.Format(responseTimes.Max()))
+	}
+	p99 := make([]time.Duration, len(d.history))
+	for i, s := range d.history {
+		p99[i] = s.p99
+	}
+	fmt.Fprintf(buffer, "p99 history:  %s %s %s\n\n", sparkline(p99), unit.Format(current.p99), unit)
+
+	if len(stats.statusCodes) > 0 {
+		var codeList []int
+		for code := range stats.statusCodes {
+			codeList = append(codeList, code)
+		}
+		sort.Ints(codeList)
+
+		fmt.Fprint(buffer, "Status codes:\n")
+		for _, code := range codeList {
+			fmt.Fprintf(buffer, "  %-28s\t%d\n", fmt.Sprintf("%d %s", code, http.StatusText(code)), stats.statusCodes[code])
+		}
+	}
+	if len(stats.errKinds) > 0 {
+		fmt.Fprint(buffer, "Errors:\n")
+		for _, kind := range sortedKeys(stats.errKinds) {
+			fmt.Fprintf(buffer, "  %-28s\t%d\n", kind, stats.errKinds[kind])
+		}
+	}
+}
+
+// sparkline draws values as bars scaled to the largest of them.
+func sparkline(values []time.Duration) string {
+	var highest time.Duration
+	for _, v := range values {
+		highest = max(highest, v)
+	}
+
+	bars := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if highest > 0 {
+			level = int(int64(v) * int64(len(sparks)-1) / int64(highest))
+		}
+		bars[i] = sparks[level]
+	}
+	return string(bars)
+}
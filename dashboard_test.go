@@ -0,0 +1,94 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	if actual := sparkline([]time.Duration{0, 1, 4, 7}); actual != "▁▂▅█" {
+		t.Errorf("unexpected sparkline %q", actual)
+	}
+	if actual := sparkline([]time.Duration{0, 0}); actual != "▁▁" {
+		t.Errorf("unexpected sparkline %q", actual)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	config := &Config{url: "http://localhost/", requests: 100, conns: &ConnCounter{}}
+	start := time.Now()
+	dashboard := NewDashboard(NewContext(config), nil, start)
+
+	stats := &Stats{}
+	for i := 0; i < 10; i++ {
+		record := &Record{responseTime: time.Duration(i+1) * time.Millisecond, statusCode: 200}
+		if i == 9 {
+			record.statusCode = 503
+			record.Error = &ResponseError{errors.New("Response is 503")}
+		}
+		updateStats(stats, record)
+		updateStatusStats(stats, record)
+		dashboard.record(record)
+	}
+
+	var out bytes.Buffer
+	dashboard.out = &out
+	dashboard.Refresh(start.Add(2*time.Second), stats)
+
+	for _, line := range []string{
+		ansiClear,
+		"Remaining:    18s (10 of 100 requests)",
+		"Requests:     10 (success 9, failed 1)",
+		"RPS:          5.00 current, 5.00 average",
+		"Connections:  0 active, 0 opened",
+		"Latency (ms): p50 5.0",
+		"503 Service Unavailable",
+		"Response                    \t1",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in the dashboard:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestConnCounter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	defer ln.Close()
+
+	counter := &ConnCounter{}
+	dial := NewDialer(&Config{conns: counter})
+	first, err := dial(context.Background(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	second, _ := dial(context.Background(), "tcp", ln.Addr().String())
+	first.Close()
+	first.Close()
+
+	if counter.Opened() != 2 || counter.Open() != 1 {
+		t.Fatalf("expected 2 opened and 1 open connection, got %d and %d", counter.Opened(), counter.Open())
+	}
+	second.Close()
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp("", "gbtest")
+	if err != nil {
+		t.Fatalf("create temp file failed: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if isTerminal(f) {
+		t.Fatal("expected a file not to be a terminal")
+	}
+}
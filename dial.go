@@ -0,0 +1,291 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDialer returns the dial function shared by all of clients. Connections
+// go to the unix socket instead of addr when one is configured. Connections
+// are counted by config.conns if set.
+func NewDialer(config *Config) DialFunc {
+	dial := newBaseDialer(config)
+	if config.conns != nil {
+		dial = config.conns.wrap(dial)
+	}
+	return dial
+}
+
+func newBaseDialer(config *Config) DialFunc {
+	options := config.tcpOptions
+	if options == nil {
+		options = DefaultTCPOptions()
+	}
+	dialer := options.newDialer()
+
+	if config.unixSocket != "" {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", config.unixSocket)
+		}
+	}
+
+	dial := options.wrap(dialer.DialContext)
+	if config.resolver != nil || config.sourceAddrs != nil {
+		dial = options.wrap(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := dialer
+			if config.sourceAddrs != nil {
+				local := *dialer
+				local.LocalAddr = &net.TCPAddr{IP: config.sourceAddrs.Next()}
+				d = &local
+			}
+			if config.resolver != nil {
+				return config.resolver.dial(ctx, d, network, addr)
+			}
+			return d.DialContext(ctx, network, addr)
+		})
+	}
+
+	if config.proxy != nil {
+		URL, _ := url.Parse(config.url)
+		return config.proxy.dialer(dial, config.proxy.Tunnel(URL.Scheme), newClientTLSConfig(config))
+	}
+	return dial
+}
+
+// MaxSourceAddrs limits the number of addresses expanded from a CIDR.
+const MaxSourceAddrs = 65536
+
+// SourceAddrs is the list of local addresses which outgoing connections are
+// bound to in turn.
+type SourceAddrs struct {
+	ips  []net.IP
+	next uint32
+}
+
+// NewSourceAddrs parses addresses and CIDRs, eg. '10.0.0.1' or '10.0.0.0/28'.
+// The network and broadcast addresses of IPv4 CIDRs are skipped.
+func NewSourceAddrs(specs []string) (*SourceAddrs, error) {
+	s := &SourceAddrs{}
+
+	for _, spec := range specs {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			if !strings.Contains(item, "/") {
+				ip := net.ParseIP(item)
+				if ip == nil {
+					return nil, errors.New("invalid source address: " + item)
+				}
+				s.ips = append(s.ips, ip)
+				continue
+			}
+
+			_, ipnet, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, err
+			}
+			ones, bits := ipnet.Mask.Size()
+			skipEdges := bits == 32 && ones < 31
+
+			for ip := ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); ip = nextIP(ip) {
+				if len(s.ips) >= MaxSourceAddrs {
+					return nil, fmt.Errorf("too many source addresses, the limit is %d", MaxSourceAddrs)
+				}
+				if skipEdges && (ip.Equal(ipnet.IP) || !ipnet.Contains(nextIP(ip))) {
+					continue
+				}
+				s.ips = append(s.ips, ip)
+			}
+		}
+	}
+
+	if len(s.ips) == 0 {
+		return nil, errors.New("no source address given")
+	}
+	return s, nil
+}
+
+func (s *SourceAddrs) Next() net.IP {
+	return s.ips[(atomic.AddUint32(&s.next, 1)-1)%uint32(len(s.ips))]
+}
+
+func (s *SourceAddrs) Len() int {
+	return len(s.ips)
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// isPortExhausted reports whether a dial failed because no local address and
+// port pair is left (EADDRNOTAVAIL).
+func isPortExhausted(err error) bool {
+	return errors.Is(err, syscall.EADDRNOTAVAIL)
+}
+
+// Resolver resolves target addresses for the dialer. It takes curl-style
+// host:port:addr overrides, an optional DNS server, and can spread connections
+// round-robin over all of resolved addresses. Lookups are cached for the run.
+type Resolver struct {
+	overrides map[string][]string
+	resolver  *net.Resolver
+	spread    bool
+
+	next  uint32
+	mu    sync.Mutex
+	cache map[string][]string
+}
+
+func NewResolver(overrides []string, server string, spread bool) (*Resolver, error) {
+	r := &Resolver{
+		overrides: make(map[string][]string),
+		resolver:  net.DefaultResolver,
+		spread:    spread,
+		cache:     make(map[string][]string),
+	}
+
+	for _, override := range overrides {
+		parts := strings.SplitN(override, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("invalid resolve entry, expected host:port:addr - " + override)
+		}
+
+		var addrs []string
+		for _, addr := range strings.Split(parts[2], ",") {
+			addr = strings.Trim(strings.TrimSpace(addr), "[]")
+			if net.ParseIP(addr) == nil {
+				return nil, errors.New("invalid address in resolve entry: " + override)
+			}
+			addrs = append(addrs, net.JoinHostPort(addr, parts[1]))
+		}
+		key := net.JoinHostPort(parts[0], parts[1])
+		r.overrides[key] = append(r.overrides[key], addrs...)
+	}
+
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		dialer := &net.Dialer{}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Resolver) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (conn net.Conn, err error) {
+	addrs, err := r.lookup(ctx, addr)
+	if err != nil {
+		return
+	}
+
+	start := 0
+	if r.spread {
+		start = int((atomic.AddUint32(&r.next, 1) - 1) % uint32(len(addrs)))
+	}
+
+	for i := range addrs {
+		if conn, err = dialer.DialContext(ctx, network, addrs[(start+i)%len(addrs)]); err == nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *Resolver) lookup(ctx context.Context, addr string) ([]string, error) {
+	if addrs, ok := r.overrides[addr]; ok {
+		return addrs, nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{addr}, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if addrs, ok := r.cache[addr]; ok {
+		return addrs, nil
+	}
+
+	ips, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no addresses found for " + host)
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	r.cache[addr] = addrs
+	return addrs, nil
+}
+
+func updateRemoteAddrStats(stats *Stats, record *Record) {
+	if record.remoteAddr == "" {
+		return
+	}
+
+	if stats.remoteAddrs == nil {
+		stats.remoteAddrs = make(map[string]int)
+		stats.remoteAddrsDur = make(map[string]time.Duration)
+		stats.remoteAddrsFailed = make(map[string]int)
+	}
+
+	stats.remoteAddrs[record.remoteAddr]++
+	if record.Error != nil {
+		stats.remoteAddrsFailed[record.remoteAddr]++
+	} else {
+		stats.remoteAddrsDur[record.remoteAddr] += record.responseTime
+	}
+}
+
+func printRemoteAddrStats(buffer *bytes.Buffer, stats *Stats, unit TimeUnit) {
+	var addrs []string
+	for addr := range stats.remoteAddrs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	fmt.Fprintf(buffer, "Requests per address and avg Query Times(%s)\n", unit)
+	fmt.Fprint(buffer, "  Address                \tTotal\tFailed\tTimes\n")
+	for _, addr := range addrs {
+		success := stats.remoteAddrs[addr] - stats.remoteAddrsFailed[addr]
+		fmt.Fprintf(buffer, "  %-23s\t%d\t%d\t%s\n", addr, stats.remoteAddrs[addr], stats.remoteAddrsFailed[addr], unit.Format(avg(stats.remoteAddrsDur[addr], success)))
+	}
+}
@@ -0,0 +1,229 @@
+package gb
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func acceptAll(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}
+}
+
+func TestNewResolverWithInvalidEntry(t *testing.T) {
+	testData := []string{
+		"example.com:443",
+		"example.com:443:not-an-ip",
+		":443:127.0.0.1",
+	}
+
+	for _, entry := range testData {
+		if _, err := NewResolver([]string{entry}, "", false); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
+
+func TestResolverWithOverride(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	defer listener.Close()
+	go acceptAll(listener)
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	resolver, err := NewResolver([]string{"gb.invalid:" + port + ":127.0.0.1"}, "", false)
+	if err != nil {
+		t.Fatalf("new resolver failed: %s", err)
+	}
+
+	dial := NewDialer(&Config{resolver: resolver})
+	conn, err := dial(context.Background(), "tcp", "gb.invalid:"+port)
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	defer conn.Close()
+
+	if conn.RemoteAddr().String() != listener.Addr().String() {
+		t.Fatalf("expected connection to %s, got %s", listener.Addr(), conn.RemoteAddr())
+	}
+}
+
+func TestResolverWithSpread(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	defer first.Close()
+	go acceptAll(first)
+
+	port := strconv.Itoa(first.Addr().(*net.TCPAddr).Port)
+	second, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		t.Skipf("listen on 127.0.0.2 failed: %s", err)
+	}
+	defer second.Close()
+	go acceptAll(second)
+
+	resolver, err := NewResolver([]string{"gb.invalid:" + port + ":127.0.0.1,127.0.0.2"}, "", true)
+	if err != nil {
+		t.Fatalf("new resolver failed: %s", err)
+	}
+
+	dial := NewDialer(&Config{resolver: resolver})
+	stats := &Stats{}
+	for i := 0; i < 4; i++ {
+		conn, err := dial(context.Background(), "tcp", "gb.invalid:"+port)
+		if err != nil {
+			t.Fatalf("dial failed: %s", err)
+		}
+		updateRemoteAddrStats(stats, &Record{remoteAddr: conn.RemoteAddr().String()})
+		conn.Close()
+	}
+
+	if stats.remoteAddrs[first.Addr().String()] != 2 || stats.remoteAddrs[second.Addr().String()] != 2 {
+		t.Fatalf("expected connections spread evenly, got %v", stats.remoteAddrs)
+	}
+}
+
+// serveDNS answers A queries with ip and any other query with no records.
+func serveDNS(conn net.PacketConn, ip net.IP) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		// question name ends with a zero length label, followed by type and class
+		end := 12
+		for end < n && buf[end] != 0 {
+			end += int(buf[end]) + 1
+		}
+		end += 5
+		if end > n {
+			continue
+		}
+		qtype := binary.BigEndian.Uint16(buf[end-4:])
+
+		response := make([]byte, 0, 512)
+		response = append(response, buf[0], buf[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0)
+		response = append(response, buf[12:end]...)
+		if qtype == 1 {
+			response[7] = 1
+			response = append(response, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+			response = append(response, ip.To4()...)
+		}
+		conn.WriteTo(response, addr)
+	}
+}
+
+func TestResolverWithDNSServer(t *testing.T) {
+	dns, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	defer dns.Close()
+	go serveDNS(dns, net.ParseIP("127.0.0.1"))
+
+	resolver, err := NewResolver(nil, dns.LocalAddr().String(), false)
+	if err != nil {
+		t.Fatalf("new resolver failed: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := resolver.lookup(ctx, "app.gb.test:8080")
+	if err != nil {
+		t.Fatalf("lookup failed: %s", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1:8080" {
+		t.Fatalf("expected 127.0.0.1:8080, got %v", addrs)
+	}
+}
+
+func TestNewSourceAddrs(t *testing.T) {
+	testData := map[string][]string{
+		"10.0.0.1":             {"10.0.0.1"},
+		"10.0.0.1, 10.0.0.5":   {"10.0.0.1", "10.0.0.5"},
+		"10.0.0.0/30":          {"10.0.0.1", "10.0.0.2"},
+		"10.0.0.8/31":          {"10.0.0.8", "10.0.0.9"},
+		"fd00::/127":           {"fd00::", "fd00::1"},
+		"192.168.0.255/32":     {"192.168.0.255"},
+		"10.0.0.0/30,10.0.1.1": {"10.0.0.1", "10.0.0.2", "10.0.1.1"},
+	}
+
+	for spec, expected := range testData {
+		sources, err := NewSourceAddrs([]string{spec})
+		if err != nil {
+			t.Errorf("parse %s failed: %s", spec, err)
+			continue
+		}
+
+		var actual []string
+		for i := 0; i < sources.Len(); i++ {
+			actual = append(actual, sources.Next().String())
+		}
+		if strings.Join(actual, " ") != strings.Join(expected, " ") {
+			t.Errorf("parse %s expected %v, got %v", spec, expected, actual)
+		}
+	}
+
+	for _, spec := range []string{"", "10.0.0", "10.0.0.0/33", "10.0.0.0/8"} {
+		if _, err := NewSourceAddrs([]string{spec}); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestDialWithSourceAddrs(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	defer listener.Close()
+	go acceptAll(listener)
+
+	sources, _ := NewSourceAddrs([]string{"127.0.0.2,127.0.0.3"})
+	dial := NewDialer(&Config{sourceAddrs: sources})
+
+	for _, expected := range []string{"127.0.0.2", "127.0.0.3", "127.0.0.2"} {
+		conn, err := dial(context.Background(), "tcp", listener.Addr().String())
+		if err != nil {
+			t.Skipf("dial from %s failed: %s", expected, err)
+		}
+		if actual := conn.LocalAddr().(*net.TCPAddr).IP.String(); actual != expected {
+			t.Fatalf("expected source address %s, got %s", expected, actual)
+		}
+		conn.Close()
+	}
+}
+
+func TestDialWithUnavailableSourceAddr(t *testing.T) {
+	// TEST-NET-1 is not assigned to any local interface
+	sources, _ := NewSourceAddrs([]string{"192.0.2.1"})
+	dial := NewDialer(&Config{sourceAddrs: sources})
+
+	_, err := dial(context.Background(), "tcp", "127.0.0.1:80")
+	if !isPortExhausted(err) {
+		t.Fatalf("expected EADDRNOTAVAIL, got %v", err)
+	}
+
+	stats := &Stats{}
+	updateStats(stats, &Record{Error: &PortExhaustedError{err}})
+	if stats.errPortExhausted != 1 || stats.errConnect != 0 {
+		t.Fatalf("expected port exhausted error, got %#+v", stats)
+	}
+}
@@ -0,0 +1,174 @@
+package gb
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-errors/errors"
+)
+
+// DigestAuth answers HTTP Digest challenges of RFC 7616. The challenge of the
+// first 401 response is kept and answered in advance for later requests.
+type DigestAuth struct {
+	username string
+	password string
+
+	mu        sync.RWMutex
+	challenge map[string]string
+	nc        uint32
+}
+
+// NewDigestAuth takes credentials as 'username:password', the password may
+// contain colons.
+func NewDigestAuth(credentials string) (*DigestAuth, error) {
+	pair := strings.SplitN(credentials, ":", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return nil, errors.New("digest credentials must be username:password")
+	}
+	return &DigestAuth{username: pair[0], password: pair[1]}, nil
+}
+
+func (d *DigestAuth) Authenticate(request *http.Request) error {
+	d.mu.RLock()
+	challenge := d.challenge
+	d.mu.RUnlock()
+
+	if challenge == nil {
+		return nil
+	}
+	return d.answer(request, challenge, atomic.AddUint32(&d.nc, 1))
+}
+
+func (d *DigestAuth) Challenge(response *http.Response) bool {
+	for _, header := range response.Header.Values("WWW-Authenticate") {
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Digest ") {
+			continue
+		}
+		challenge := parseAuthParams(header[7:])
+		if challenge["nonce"] == "" {
+			continue
+		}
+
+		d.mu.Lock()
+		// a repeated challenge with the same nonce means the credentials
+		// were rejected
+		stale := d.challenge == nil || d.challenge["nonce"] != challenge["nonce"]
+		if stale {
+			d.challenge = challenge
+			atomic.StoreUint32(&d.nc, 0)
+		}
+		d.mu.Unlock()
+		return stale
+	}
+	return false
+}
+
+func (d *DigestAuth) answer(request *http.Request, challenge map[string]string, nc uint32) error {
+	algorithm := challenge["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+
+	var newHash func() hash.Hash
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS")) {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return errors.New("unsupported digest algorithm: " + algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	cnonce := make([]byte, 8)
+	rand.Read(cnonce)
+	cnonceHex := hex.EncodeToString(cnonce)
+	ncHex := fmt.Sprintf("%08x", nc)
+	uri := request.URL.RequestURI()
+
+	ha1 := h(d.username + ":" + challenge["realm"] + ":" + d.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + challenge["nonce"] + ":" + cnonceHex)
+	}
+	ha2 := h(request.Method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(challenge["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, challenge["nonce"], ncHex, cnonceHex, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + challenge["nonce"] + ":" + ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		d.username, challenge["realm"], challenge["nonce"], uri, algorithm, response)
+	if opaque, ok := challenge["opaque"]; ok {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	if qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, ncHex, cnonceHex)
+	}
+	request.Header.Set("Authorization", header)
+	return nil
+}
+
+func (d *DigestAuth) String() string {
+	return "digest (" + d.username + ")"
+}
+
+// parseAuthParams parses comma separated key=value pairs of an authentication
+// header, values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimSpace(s[i+1:])
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i = 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			s = s[min(i+1, len(s)):]
+		} else {
+			i = strings.Index(s, ",")
+			if i < 0 {
+				i = len(s)
+			}
+			value = strings.TrimSpace(s[:i])
+			s = s[i:]
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(s), ",")
+	}
+	return params
+}
@@ -0,0 +1,156 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/go-errors/errors"
+)
+
+// Kinds of errors reported, the ones which are not told apart by their cause
+// are named after the error type.
+const (
+	ErrKindDNS              = "DNS failure"
+	ErrKindRefused          = "Connection refused"
+	ErrKindReset            = "Connection reset"
+	ErrKindTLS              = "TLS error"
+	ErrKindDialTimeout      = "Dial timeout"
+	ErrKindReadTimeout      = "Read timeout"
+	ErrKindExecutionTimeout = "Execution timeout"
+	ErrKindCanceled         = "Canceled"
+	ErrKindPortExhausted    = "Port exhausted"
+	ErrKindAuth             = "Authentication"
+	ErrKindRedirect         = "Too many redirects"
+	ErrKindResponse         = "Response"
+	ErrKindLength           = "Length"
+	ErrKindConnect          = "Connect"
+	ErrKindReceive          = "Receive"
+	ErrKindException        = "Exception"
+)
+
+const (
+	// MaxErrorMessages limits the distinct messages kept of an error kind,
+	// further ones are counted as ErrOtherMessages.
+	MaxErrorMessages = 100
+	ErrOtherMessages = "(other messages)"
+	// TopErrorMessages is the number of messages reported of an error kind.
+	TopErrorMessages = 3
+)
+
+// errorKind classifies a recorded error by its cause.
+func errorKind(err error) string {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var netErr net.Error
+
+	switch err.(type) {
+	case *PortExhaustedError:
+		return ErrKindPortExhausted
+	case *AuthError:
+		return ErrKindAuth
+	case *RedirectError:
+		return ErrKindRedirect
+	case *ResponseError:
+		return ErrKindResponse
+	case *LengthError:
+		return ErrKindLength
+	case *ResponseTimeoutError:
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return ErrKindReadTimeout
+		}
+		return ErrKindExecutionTimeout
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "request canceled"):
+		return ErrKindCanceled
+	case errors.As(err, &dnsErr):
+		return ErrKindDNS
+	case isTLSError(err):
+		return ErrKindTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return ErrKindDialTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrKindRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrKindReset
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrKindReadTimeout
+	}
+
+	switch err.(type) {
+	case *ConnectError:
+		return ErrKindConnect
+	case *ReceiveError:
+		return ErrKindReceive
+	}
+	return ErrKindException
+}
+
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) ||
+		strings.Contains(err.Error(), "tls: ")
+}
+
+func updateErrorKinds(stats *Stats, err error) {
+	if stats.errKinds == nil {
+		stats.errKinds = make(map[string]int)
+		stats.errMessages = make(map[string]map[string]int)
+	}
+
+	kind := errorKind(err)
+	stats.errKinds[kind]++
+
+	messages := stats.errMessages[kind]
+	if messages == nil {
+		messages = make(map[string]int)
+		stats.errMessages[kind] = messages
+	}
+	message := err.Error()
+	if _, ok := messages[message]; !ok && len(messages) >= MaxErrorMessages {
+		message = ErrOtherMessages
+	}
+	messages[message]++
+}
+
+// sortedKeys returns the keys of counts by descending count.
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func printErrorKinds(buffer *bytes.Buffer, stats *Stats) {
+	fmt.Fprint(buffer, "Error kinds and top messages\n")
+	for _, kind := range sortedKeys(stats.errKinds) {
+		fmt.Fprintf(buffer, "  %-20s\t%d\n", kind+":", stats.errKinds[kind])
+
+		messages := sortedKeys(stats.errMessages[kind])
+		for _, message := range messages[:min(len(messages), TopErrorMessages)] {
+			fmt.Fprintf(buffer, "  %22d\t%s\n", stats.errMessages[kind][message], message)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestErrorKind(t *testing.T) {
+	for expected, err := range map[string]error{
+		ErrKindDNS:              &ConnectError{&url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "invalid"}}}},
+		ErrKindRefused:          &ConnectError{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}},
+		ErrKindReset:            &ReceiveError{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}},
+		ErrKindTLS:              &ConnectError{tls.RecordHeaderError{Msg: "tls: first record does not look like a TLS handshake"}},
+		ErrKindDialTimeout:      &ConnectError{&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}},
+		ErrKindReadTimeout:      &ResponseTimeoutError{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}},
+		ErrKindExecutionTimeout: &ResponseTimeoutError{errors.New("execution timeout")},
+		ErrKindCanceled:         &ConnectError{&url.Error{Op: "Get", Err: context.Canceled}},
+		ErrKindAuth:             &AuthError{errors.New("fetch OAuth2 token failed")},
+		ErrKindRedirect:         &RedirectError{errors.New("stopped after 10 redirects")},
+		ErrKindResponse:         &ResponseError{errors.New("Response is 500")},
+		ErrKindConnect:          &ConnectError{errors.New("proxy refused")},
+		ErrKindException:        &ExceptionError{errors.New("boom")},
+	} {
+		if actual := errorKind(err); actual != expected {
+			t.Errorf("expected %s for %q, got %s", expected, err, actual)
+		}
+	}
+}
+
+func TestErrorKindOfDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err = NewDialer(&Config{})(context.Background(), "tcp", addr)
+	if err == nil {
+		t.Fatal("expected dial to the closed port to fail")
+	}
+	if actual := errorKind(&ConnectError{err}); actual != ErrKindRefused {
+		t.Fatalf("expected %s for %q, got %s", ErrKindRefused, err, actual)
+	}
+}
+
+func TestErrorKindsStats(t *testing.T) {
+	stats := &Stats{}
+	for i := 0; i < MaxErrorMessages+10; i++ {
+		updateErrorKinds(stats, &ResponseTimeoutError{fmt.Errorf("timeout %d", i%(MaxErrorMessages+5))})
+	}
+	updateErrorKinds(stats, &ExceptionError{errors.New("boom")})
+
+	if stats.errKinds[ErrKindExecutionTimeout] != MaxErrorMessages+10 || stats.errKinds[ErrKindException] != 1 {
+		t.Fatalf("unexpected error kinds %v", stats.errKinds)
+	}
+	if messages := stats.errMessages[ErrKindExecutionTimeout]; len(messages) != MaxErrorMessages+1 || messages[ErrOtherMessages] != 5 {
+		t.Fatalf("expected %d messages and 5 others, got %d and %d", MaxErrorMessages, len(messages)-1, messages[ErrOtherMessages])
+	}
+
+	var buffer bytes.Buffer
+	printErrorKinds(&buffer, stats)
+	lines := strings.Split(buffer.String(), "\n")
+	if len(lines) != 2+TopErrorMessages+2+1 || !strings.HasPrefix(lines[1], "  "+ErrKindExecutionTimeout+":") ||
+		!strings.HasSuffix(lines[2], "\t"+ErrOtherMessages) || !strings.HasSuffix(lines[5], "\t1") {
+		t.Fatalf("unexpected error kinds report:\n%s", buffer.String())
+	}
+}
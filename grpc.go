@@ -0,0 +1,449 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/go-errors/errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	FieldGRPCMethod   = "GRPCMethod"
+	FieldGRPCRequests = "GRPCRequests"
+)
+
+type GRPCWorker struct {
+	c         *Context
+	conn      *grpc.ClientConn
+	err       error
+	method    protoreflect.MethodDescriptor
+	jobs      chan proto.Message
+	collector chan *Record
+}
+
+func NewGRPCWorker(context *Context, method protoreflect.MethodDescriptor, jobs chan proto.Message, collector chan *Record) *GRPCWorker {
+	conn, err := NewGRPCConn(context.config)
+	return &GRPCWorker{context, conn, err, method, jobs, collector}
+}
+
+func (h *GRPCWorker) Run(i int) {
+	h.c.start.Done()
+	h.c.startRun.Wait()
+
+	if h.conn != nil {
+		defer h.conn.Close()
+	}
+
+	// cancel in-flight calls as soon as the benchmark is stopped
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-h.c.stop
+		cancel()
+	}()
+
+	var count int = 0
+	for job := range h.jobs {
+
+		TakeRatelimitToken(i)
+		count++
+
+		ctx, done := context.WithTimeout(base, h.c.config.executionTimeout)
+		h.c.BeginRequest()
+		record := h.send(ctx, job)
+		h.c.EndRequest()
+		done()
+
+		select {
+		case <-h.c.stop:
+			return
+		default:
+		}
+
+		if !h.c.config.skipFirst || count > 1 {
+			h.collector <- record
+		}
+	}
+}
+
+func (h *GRPCWorker) send(ctx context.Context, request proto.Message) *Record {
+	record := &Record{}
+	sw := &StopWatch{}
+	sw.Start()
+
+	var err error
+	if h.err != nil {
+		err = h.err
+	} else {
+		record.contentSize, err = h.call(ctx, request)
+	}
+
+	sw.Stop()
+	record.responseTime = sw.Elapsed
+
+	if err != nil {
+		record.Error = grpcError(err)
+		TraceException(record.Error.Error())
+	}
+	return record
+}
+
+// call performs a unary or server-streaming call and returns the size of the
+// received messages.
+func (h *GRPCWorker) call(ctx context.Context, request proto.Message, opts ...grpc.CallOption) (n int64, err error) {
+	fullMethod := grpcFullMethodName(h.method)
+
+	if !h.method.IsStreamingServer() {
+		response := dynamicpb.NewMessage(h.method.Output())
+		if err = h.conn.Invoke(ctx, fullMethod, request, response, opts...); err != nil {
+			return
+		}
+		return int64(proto.Size(response)), nil
+	}
+
+	desc := &grpc.StreamDesc{StreamName: string(h.method.Name()), ServerStreams: true}
+	stream, err := h.conn.NewStream(ctx, desc, fullMethod, opts...)
+	if err != nil {
+		return
+	}
+	if err = stream.SendMsg(request); err != nil {
+		return
+	}
+	if err = stream.CloseSend(); err != nil {
+		return
+	}
+
+	for {
+		response := dynamicpb.NewMessage(h.method.Output())
+		if err = stream.RecvMsg(response); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return
+		}
+		n += int64(proto.Size(response))
+	}
+}
+
+func DetectGRPCHost(context *Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "err recovered %s \n\n", errors.Wrap(r, 2).ErrorStack())
+			TraceException(r)
+		}
+	}()
+
+	method, err := LoadGRPCMethod(context.config)
+	if err != nil {
+		return
+	}
+	context.SetValue(FieldGRPCMethod, method)
+
+	requests, err := NewGRPCRequestTemplate(context.config, method)
+	if err != nil {
+		return
+	}
+	context.SetValue(FieldGRPCRequests, requests)
+
+	request, err := requests.Message(0)
+	if err != nil {
+		return
+	}
+
+	worker := NewGRPCWorker(context, method, nil, nil)
+	if worker.err != nil {
+		return worker.err
+	}
+	defer worker.conn.Close()
+
+	ctx, cancel := newGRPCTimeoutContext(context.config)
+	defer cancel()
+
+	var header metadata.MD
+	var remote peer.Peer
+	contentSize, err := worker.call(ctx, request, grpc.Header(&header), grpc.Peer(&remote))
+	if err != nil {
+		return
+	}
+
+	if tlsInfo, ok := remote.AuthInfo.(credentials.TLSInfo); ok {
+		context.SetValue(FieldTLSState, &tlsInfo.State)
+	}
+
+	var serverName string
+	if values := header.Get("server"); len(values) > 0 {
+		serverName = values[0]
+	}
+	context.SetString(FieldServerName, serverName)
+	context.SetInt(FieldContentSize, int(contentSize))
+
+	return
+}
+
+func NewGRPCConn(config *Config) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if URL, err := url.Parse(config.url); err == nil && URL.Scheme == "grpcs" {
+		creds = credentials.NewTLS(newClientTLSConfig(config))
+	}
+
+	dial := NewDialer(config)
+	target := "passthrough:///" + net.JoinHostPort(config.host, strconv.Itoa(config.port))
+	return grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}))
+}
+
+// LoadGRPCMethod resolves the configured method from a protoset file, or from
+// server reflection when no protoset is given.
+func LoadGRPCMethod(config *Config) (method protoreflect.MethodDescriptor, err error) {
+	serviceName, methodName, err := splitGRPCMethodName(config.grpcMethod)
+	if err != nil {
+		return
+	}
+
+	var files *protoregistry.Files
+	if config.grpcProtoset != "" {
+		files, err = loadProtoset(config.grpcProtoset)
+	} else {
+		files, err = loadReflection(config, serviceName)
+	}
+	if err != nil {
+		return
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %s", serviceName, err)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", serviceName)
+	}
+
+	method = service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", methodName, serviceName)
+	}
+	if method.IsStreamingClient() {
+		return nil, fmt.Errorf("client-streaming method %s is not supported", config.grpcMethod)
+	}
+	return
+}
+
+func splitGRPCMethodName(name string) (service string, method string, err error) {
+	name = strings.TrimPrefix(name, "/")
+	pos := strings.LastIndex(name, "/")
+	if pos < 0 {
+		pos = strings.LastIndex(name, ".")
+	}
+	if pos <= 0 || pos == len(name)-1 {
+		return "", "", fmt.Errorf("invalid grpc method %q, expected package.Service/Method", name)
+	}
+	return name[:pos], name[pos+1:], nil
+}
+
+func grpcFullMethodName(method protoreflect.MethodDescriptor) string {
+	return "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+}
+
+func loadProtoset(filename string) (*protoregistry.Files, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("invalid protoset %s: %s", filename, err)
+	}
+	return protodesc.NewFiles(set)
+}
+
+func loadReflection(config *Config, serviceName string) (*protoregistry.Files, error) {
+	conn, err := NewGRPCConn(config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := newGRPCTimeoutContext(config)
+	defer cancel()
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	pending := []*rpb.ServerReflectionRequest{
+		{MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: serviceName}},
+	}
+
+	for len(pending) > 0 {
+		request := pending[0]
+		pending = pending[1:]
+
+		if byName, ok := request.MessageRequest.(*rpb.ServerReflectionRequest_FileByFilename); ok && seen[byName.FileByFilename] {
+			continue
+		}
+
+		if err := stream.Send(request); err != nil {
+			return nil, err
+		}
+		response, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if errResp := response.GetErrorResponse(); errResp != nil {
+			return nil, fmt.Errorf("server reflection: %s", errResp.ErrorMessage)
+		}
+
+		var received []*descriptorpb.FileDescriptorProto
+		for _, raw := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, file); err != nil {
+				return nil, err
+			}
+			if !seen[file.GetName()] {
+				seen[file.GetName()] = true
+				set.File = append(set.File, file)
+				received = append(received, file)
+			}
+		}
+
+		for _, file := range received {
+			for _, dependency := range file.GetDependency() {
+				if !seen[dependency] {
+					pending = append(pending, &rpb.ServerReflectionRequest{
+						MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dependency},
+					})
+				}
+			}
+		}
+	}
+
+	return protodesc.NewFiles(set)
+}
+
+func newGRPCTimeoutContext(config *Config) (context.Context, context.CancelFunc) {
+	timeout := config.executionTimeout
+	if timeout <= 0 {
+		timeout = MaxExecutionTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// GRPCRequestTemplate builds request messages from a JSON template. Templates
+// which contain actions, eg. '{"id": "{{.Index}}"}', are executed for every
+// request; otherwise one message is shared by all of requests.
+type GRPCRequestTemplate struct {
+	method   protoreflect.MethodDescriptor
+	template *template.Template
+	static   proto.Message
+}
+
+func NewGRPCRequestTemplate(config *Config, method protoreflect.MethodDescriptor) (*GRPCRequestTemplate, error) {
+	data := config.grpcData
+	if data == "" {
+		data = "{}"
+	}
+
+	t := &GRPCRequestTemplate{method: method}
+	if !strings.Contains(data, "{{") {
+		message, err := t.unmarshal([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		t.static = message
+		return t, nil
+	}
+
+	tmpl, err := template.New("grpc").Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	t.template = tmpl
+	return t, nil
+}
+
+func (t *GRPCRequestTemplate) Message(index int) (proto.Message, error) {
+	if t.static != nil {
+		return t.static, nil
+	}
+
+	var buffer bytes.Buffer
+	if err := t.template.Execute(&buffer, struct{ Index int }{index}); err != nil {
+		return nil, err
+	}
+	return t.unmarshal(buffer.Bytes())
+}
+
+func (t *GRPCRequestTemplate) unmarshal(data []byte) (proto.Message, error) {
+	message := dynamicpb.NewMessage(t.method.Input())
+	if err := protojson.Unmarshal(data, message); err != nil {
+		return nil, fmt.Errorf("invalid grpc request data: %s", err)
+	}
+	return message, nil
+}
+
+// grpcError folds a gRPC call error into the error types used by Stats.
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return &ConnectError{err}
+	case codes.DeadlineExceeded:
+		return &ResponseTimeoutError{err}
+	case codes.Unknown:
+		if _, ok := status.FromError(err); !ok {
+			return &ExceptionError{err}
+		}
+	}
+	return &ResponseError{err}
+}
+
+// grpcCode returns the gRPC status code of a recorded error.
+func grpcCode(err error) codes.Code {
+	switch e := err.(type) {
+	case nil:
+		return codes.OK
+	case *ConnectError:
+		return status.Code(e.err)
+	case *ResponseError:
+		return status.Code(e.err)
+	case *ResponseTimeoutError:
+		return codes.DeadlineExceeded
+	case *ExceptionError:
+		return status.Code(e.err)
+	default:
+		return status.Code(err)
+	}
+}
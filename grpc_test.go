@@ -0,0 +1,313 @@
+package gb
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const grpcStreamMessages = 3
+
+// fake gRPC service described by gbtest.proto, reusing the health messages
+var benchServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gbtest.Bench",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Unary",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &healthpb.HealthCheckRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if in.Service == "missing" {
+					return nil, status.Error(codes.NotFound, "missing service")
+				}
+				return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := &healthpb.HealthCheckRequest{}
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				for i := 0; i < grpcStreamMessages; i++ {
+					if err := stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func benchProtoset() *descriptorpb.FileDescriptorSet {
+	healthFile := protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)
+	benchFile := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("gbtest.proto"),
+		Package:    proto.String("gbtest"),
+		Dependency: []string{healthFile.GetName()},
+		Syntax:     proto.String("proto3"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Bench"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:       proto.String("Unary"),
+					InputType:  proto.String(".grpc.health.v1.HealthCheckRequest"),
+					OutputType: proto.String(".grpc.health.v1.HealthCheckResponse"),
+				},
+				{
+					Name:            proto.String("Stream"),
+					InputType:       proto.String(".grpc.health.v1.HealthCheckRequest"),
+					OutputType:      proto.String(".grpc.health.v1.HealthCheckResponse"),
+					ServerStreaming: proto.Bool(true),
+				},
+			},
+		}},
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{healthFile, benchFile}}
+}
+
+func startGRPCServer(t *testing.T) (*grpc.Server, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(&benchServiceDesc, struct{}{})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	go server.Serve(listener)
+
+	return server, listener.Addr().(*net.TCPAddr).Port
+}
+
+func writeProtoset(t *testing.T) string {
+	data, err := proto.Marshal(benchProtoset())
+	if err != nil {
+		t.Fatalf("marshal protoset failed: %s", err)
+	}
+
+	file, err := ioutil.TempFile("", "gbtest-protoset")
+	if err != nil {
+		t.Fatalf("create protoset failed: %s", err)
+	}
+	defer file.Close()
+	file.Write(data)
+	return file.Name()
+}
+
+func newGRPCConfig(port int, method string) *Config {
+	return &Config{
+		concurrency:      1,
+		requests:         1,
+		executionTimeout: MaxExecutionTimeout,
+		url:              "grpc://127.0.0.1:" + strconv.Itoa(port),
+		host:             "127.0.0.1",
+		port:             port,
+		grpcMethod:       method,
+	}
+}
+
+func TestSplitGRPCMethodName(t *testing.T) {
+	testData := map[string][2]string{
+		"gbtest.Bench/Unary":  {"gbtest.Bench", "Unary"},
+		"/gbtest.Bench/Unary": {"gbtest.Bench", "Unary"},
+		"gbtest.Bench.Unary":  {"gbtest.Bench", "Unary"},
+	}
+
+	for name, expected := range testData {
+		service, method, err := splitGRPCMethodName(name)
+		if err != nil || service != expected[0] || method != expected[1] {
+			t.Errorf("expected %s and %s, got %s and %s (%v)", expected[0], expected[1], service, method, err)
+		}
+	}
+
+	if _, _, err := splitGRPCMethodName("Unary"); err == nil {
+		t.Error("expected error for method without service")
+	}
+}
+
+func TestLoadGRPCMethodFromProtoset(t *testing.T) {
+	protoset := writeProtoset(t)
+	defer os.Remove(protoset)
+
+	config := newGRPCConfig(0, "gbtest.Bench/Stream")
+	config.grpcProtoset = protoset
+
+	method, err := LoadGRPCMethod(config)
+	if err != nil {
+		t.Fatalf("load method failed: %s", err)
+	}
+
+	if grpcFullMethodName(method) != "/gbtest.Bench/Stream" || !method.IsStreamingServer() {
+		t.Fatalf("unexpected method %s", method.FullName())
+	}
+}
+
+func TestLoadGRPCMethodFromReflection(t *testing.T) {
+	server, port := startGRPCServer(t)
+	defer server.Stop()
+
+	method, err := LoadGRPCMethod(newGRPCConfig(port, "grpc.health.v1.Health/Check"))
+	if err != nil {
+		t.Fatalf("load method failed: %s", err)
+	}
+
+	if method.Input().FullName() != "grpc.health.v1.HealthCheckRequest" {
+		t.Fatalf("unexpected input type %s", method.Input().FullName())
+	}
+}
+
+func TestGRPCRequestTemplate(t *testing.T) {
+	method := healthpb.File_grpc_health_v1_health_proto.Services().ByName("Health").Methods().ByName("Check")
+
+	config := &Config{grpcData: `{"service": "svc-{{.Index}}"}`}
+	requests, err := NewGRPCRequestTemplate(config, method)
+	if err != nil {
+		t.Fatalf("new template failed: %s", err)
+	}
+
+	message, err := requests.Message(3)
+	if err != nil {
+		t.Fatalf("build message failed: %s", err)
+	}
+
+	field := method.Input().Fields().ByName("service")
+	if got := message.(*dynamicpb.Message).Get(field).String(); got != "svc-3" {
+		t.Fatalf("expected svc-3, got %s", got)
+	}
+
+	config.grpcData = `{"unknown": 1}`
+	if _, err := NewGRPCRequestTemplate(config, method); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func runGRPCWorker(t *testing.T, method string, data string) *Record {
+	server, port := startGRPCServer(t)
+	defer server.Stop()
+
+	protoset := writeProtoset(t)
+	defer os.Remove(protoset)
+
+	config := newGRPCConfig(port, method)
+	config.grpcProtoset = protoset
+	config.grpcData = data
+
+	context := NewContext(config)
+
+	descriptor, err := LoadGRPCMethod(config)
+	if err != nil {
+		t.Fatalf("load method failed: %s", err)
+	}
+	requests, _ := NewGRPCRequestTemplate(config, descriptor)
+	request, _ := requests.Message(0)
+
+	jobs := make(chan proto.Message)
+	collector := make(chan *Record)
+
+	worker := NewGRPCWorker(context, descriptor, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	jobs <- request
+	record := <-collector
+	close(jobs)
+	close(context.stop)
+
+	return record
+}
+
+func TestDetectGRPCHost(t *testing.T) {
+	server, port := startGRPCServer(t)
+	defer server.Stop()
+
+	context := NewContext(newGRPCConfig(port, "grpc.health.v1.Health/Check"))
+	if err := DetectGRPCHost(context); err != nil {
+		t.Fatalf("detect host failed: %s", err)
+	}
+
+	if context.GetValue(FieldGRPCMethod) == nil || context.GetValue(FieldGRPCRequests) == nil {
+		t.Fatal("expected method and request template in context")
+	}
+	if expected := proto.Size(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); context.GetInt(FieldContentSize) != expected {
+		t.Fatalf("expected content size %d, got %d", expected, context.GetInt(FieldContentSize))
+	}
+}
+
+func TestGRPCWorkerWithUnary(t *testing.T) {
+	record := runGRPCWorker(t, "gbtest.Bench/Unary", "{}")
+
+	if record.Error != nil {
+		t.Fatalf("sent a grpc request but was error: %s", record.Error)
+	}
+	if record.contentSize != int64(proto.Size(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})) {
+		t.Fatalf("sent a grpc request but content size dismatch: %d", record.contentSize)
+	}
+}
+
+func TestGRPCWorkerWithStream(t *testing.T) {
+	record := runGRPCWorker(t, "gbtest.Bench/Stream", "{}")
+
+	if record.Error != nil {
+		t.Fatalf("sent a grpc request but was error: %s", record.Error)
+	}
+	if expected := grpcStreamMessages * int64(proto.Size(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})); record.contentSize != expected {
+		t.Fatalf("expected %d bytes from stream, got %d", expected, record.contentSize)
+	}
+}
+
+func TestGRPCWorkerWithErrorStatus(t *testing.T) {
+	record := runGRPCWorker(t, "gbtest.Bench/Unary", `{"service": "missing"}`)
+
+	if _, ok := record.Error.(*ResponseError); !ok {
+		t.Fatalf("expected response error, got %#v", record.Error)
+	}
+	if code := grpcCode(record.Error); code != codes.NotFound {
+		t.Fatalf("expected %s, got %s", codes.NotFound, code)
+	}
+}
+
+func TestUpdateGRPCStats(t *testing.T) {
+	stats := &Stats{}
+	records := []*Record{
+		&Record{responseTime: 10 * time.Millisecond},
+		&Record{responseTime: 30 * time.Millisecond},
+		&Record{responseTime: 5 * time.Millisecond, Error: grpcError(status.Error(codes.Unavailable, "down"))},
+		&Record{responseTime: 7 * time.Millisecond, Error: grpcError(status.Error(codes.NotFound, "missing"))},
+	}
+
+	for _, record := range records {
+		updateGRPCStats(stats, record)
+	}
+
+	if stats.grpcCodes[codes.OK] != 2 || stats.grpcCodesDur[codes.OK] != 40*time.Millisecond {
+		t.Fatalf("unexpected OK stats %d %s", stats.grpcCodes[codes.OK], stats.grpcCodesDur[codes.OK])
+	}
+	if stats.grpcCodes[codes.Unavailable] != 1 || stats.grpcCodes[codes.NotFound] != 1 {
+		t.Fatalf("unexpected error stats %v", stats.grpcCodes)
+	}
+}
@@ -0,0 +1,204 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// Resumption modes of -handshake. crypto/tls resumes sessions by tickets
+// only, there is no session ID cache on the client side, so both of ticket
+// and cache modes resume by tickets; they differ in which tickets a worker
+// may offer.
+const (
+	ResumeNone   = "none"
+	ResumeTicket = "ticket" // a worker offers the ticket of its own last session
+	ResumeCache  = "cache"  // a worker offers tickets issued to any of workers
+)
+
+// TicketWait is how long a worker waits for the session tickets sent after a
+// TLS 1.3 handshake.
+const TicketWait = 100 * time.Millisecond
+
+// HandshakeWorker opens a new TLS connection for every job and measures the
+// handshake alone; no request is sent over the connection.
+type HandshakeWorker struct {
+	c         *Context
+	jobs      chan struct{}
+	collector chan *Record
+	addr      string
+	dial      DialFunc
+	tlsConfig *tls.Config
+	tickets   *ticketCache
+}
+
+// ticketCache stops waiting for the session tickets of conn as soon as one is
+// stored.
+type ticketCache struct {
+	tls.ClientSessionCache
+	conn net.Conn
+}
+
+func (c *ticketCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.ClientSessionCache.Put(sessionKey, cs)
+	if c.conn != nil && cs != nil {
+		c.conn.SetReadDeadline(time.Now())
+	}
+}
+
+// NewHandshakeWorker creates a worker resuming sessions from cache, or doing a
+// full handshake every time when cache is nil.
+func NewHandshakeWorker(context *Context, cache tls.ClientSessionCache, jobs chan struct{}, collector chan *Record) *HandshakeWorker {
+	config := context.config
+
+	tlsconfig := newClientTLSConfig(config)
+	if tlsconfig.ServerName == "" {
+		tlsconfig.ServerName = config.host
+	}
+	tlsconfig.SessionTicketsDisabled = cache == nil
+
+	worker := &HandshakeWorker{
+		c:         context,
+		jobs:      jobs,
+		collector: collector,
+		addr:      net.JoinHostPort(config.host, strconv.Itoa(config.port)),
+		dial:      NewDialer(config),
+		tlsConfig: tlsconfig,
+	}
+	if cache != nil {
+		worker.tickets = &ticketCache{ClientSessionCache: cache}
+		tlsconfig.ClientSessionCache = worker.tickets
+	}
+	return worker
+}
+
+func (h *HandshakeWorker) Run(i int) {
+	h.c.start.Done()
+	h.c.startRun.Wait()
+
+	var count int = 0
+	for range h.jobs {
+
+		TakeRatelimitToken(i)
+		count++
+		h.c.BeginRequest()
+		record := h.handshake()
+		h.c.EndRequest()
+
+		select {
+		case <-h.c.stop:
+			return
+		default:
+		}
+
+		if !h.c.config.skipFirst || count > 1 {
+			h.collector <- record
+		}
+	}
+}
+
+func (h *HandshakeWorker) handshake() (record *Record) {
+	record = &Record{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.c.config.executionTimeout)
+	defer cancel()
+
+	conn, err := h.dial(ctx, "tcp", h.addr)
+	if err != nil {
+		if isPortExhausted(err) {
+			record.Error = &PortExhaustedError{err}
+		} else {
+			record.Error = &ConnectError{err}
+		}
+		TraceException(record.Error.Error())
+		return
+	}
+	defer conn.Close()
+
+	if h.c.config.resolver != nil {
+		record.remoteAddr = conn.RemoteAddr().String()
+	}
+
+	tlsConn := tls.Client(conn, h.tlsConfig)
+
+	sw := &StopWatch{}
+	sw.Start()
+	err = tlsConn.HandshakeContext(ctx)
+	sw.Stop()
+	record.responseTime = sw.Elapsed
+
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			record.Error = &ResponseTimeoutError{err}
+		} else {
+			record.Error = &ReceiveError{err}
+		}
+		TraceException(record.Error.Error())
+		return
+	}
+	record.resumed = tlsConn.ConnectionState().DidResume
+
+	if h.tickets != nil && tlsConn.ConnectionState().Version >= tls.VersionTLS13 {
+		// TLS 1.3 session tickets are sent after the handshake, read until
+		// one is stored but not longer than TicketWait
+		h.tickets.conn = conn
+		conn.SetReadDeadline(time.Now().Add(min(TicketWait, h.c.config.executionTimeout)))
+		var b [1]byte
+		tlsConn.Read(b[:])
+		h.tickets.conn = nil
+	}
+	return
+}
+
+// NewSessionCache returns the ticket cache of the given resumption mode for a
+// worker, shared is returned in cache mode.
+func NewSessionCache(mode string, shared tls.ClientSessionCache) tls.ClientSessionCache {
+	switch mode {
+	case ResumeTicket:
+		return tls.NewLRUClientSessionCache(1)
+	case ResumeCache:
+		return shared
+	default:
+		return nil
+	}
+}
+
+func validateResumeMode(mode string) error {
+	switch mode {
+	case ResumeNone, ResumeTicket, ResumeCache:
+		return nil
+	}
+	return errors.New("unsupported TLS resumption mode: " + mode)
+}
+
+func updateHandshakeStats(stats *Stats, record *Record) {
+	if record.Error != nil {
+		return
+	}
+
+	if record.resumed {
+		stats.handshakeResumed++
+		stats.handshakeResumedDur += record.responseTime
+	} else {
+		stats.handshakeFull++
+		stats.handshakeFullDur += record.responseTime
+	}
+}
+
+func printHandshakeStats(buffer *bytes.Buffer, config *Config, stats *Stats, unit TimeUnit) {
+	total := stats.handshakeFull + stats.handshakeResumed
+
+	fmt.Fprintf(buffer, "TLS Resumption:         %s\n", config.tlsResume)
+	fmt.Fprintf(buffer, "TLS Handshakes:         %d (full: %d, resumed: %d)\n", total, stats.handshakeFull, stats.handshakeResumed)
+	if stats.totalExecutionTime > 0 {
+		fmt.Fprintf(buffer, "Handshakes per second:  %.2f [#/sec] (mean)\n", float64(total)/stats.totalExecutionTime.Seconds())
+	}
+	fmt.Fprintf(buffer, "Handshake Time:         %s [%s] (mean, full)\n", unit.Format(avg(stats.handshakeFullDur, stats.handshakeFull)), unit)
+	fmt.Fprintf(buffer, "Handshake Time:         %s [%s] (mean, resumed)\n", unit.Format(avg(stats.handshakeResumedDur, stats.handshakeResumed)), unit)
+}
@@ -0,0 +1,155 @@
+package gb
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func runHandshakeWorker(t *testing.T, mode string, requests int) []*Record {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         requests,
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		tlsHandshake:     true,
+		tlsResume:        mode,
+	}
+	URL, _ := url.Parse(ts.URL)
+	config.host, config.port, _ = extractHostAndPort(URL)
+
+	context := NewContext(config)
+	jobs := make(chan struct{}, requests)
+	collector := make(chan *Record, requests)
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	worker := NewHandshakeWorker(context, NewSessionCache(mode, nil), jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	records := make([]*Record, 0, requests)
+	for i := 0; i < requests; i++ {
+		record := <-collector
+		if record.Error != nil {
+			t.Fatalf("tls handshake failed: %s", record.Error)
+		}
+		records = append(records, record)
+	}
+	close(context.stop)
+	return records
+}
+
+func TestHandshakeWorkerWithoutResumption(t *testing.T) {
+	stats := &Stats{}
+	for _, record := range runHandshakeWorker(t, ResumeNone, 3) {
+		updateHandshakeStats(stats, record)
+	}
+
+	if stats.handshakeFull != 3 || stats.handshakeResumed != 0 {
+		t.Fatalf("expected 3 full handshakes, got %d full and %d resumed", stats.handshakeFull, stats.handshakeResumed)
+	}
+}
+
+func TestHandshakeWorkerWithTicket(t *testing.T) {
+	records := runHandshakeWorker(t, ResumeTicket, 3)
+
+	if records[0].resumed || !records[1].resumed || !records[2].resumed {
+		t.Fatalf("expected a full handshake followed by resumed ones, got %v %v %v", records[0].resumed, records[1].resumed, records[2].resumed)
+	}
+}
+
+func TestHandshakeWorkerWithServerKeepingConnections(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	// the server keeps the connections open after close_notify
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+				<-done
+			}()
+		}
+	}()
+
+	requests := 3
+	config := &Config{
+		concurrency:      1,
+		requests:         requests,
+		executionTimeout: 5 * time.Second,
+		tlsHandshake:     true,
+		tlsResume:        ResumeTicket,
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	config.host = host
+	config.port, _ = strconv.Atoi(port)
+	config.url = "https://" + ln.Addr().String() + "/"
+
+	context := NewContext(config)
+	jobs := make(chan struct{}, requests)
+	collector := make(chan *Record, requests)
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	worker := NewHandshakeWorker(context, NewSessionCache(ResumeTicket, nil), jobs, collector)
+	context.startRun.Done()
+	start := time.Now()
+	go worker.Run(0)
+
+	var records []*Record
+	for i := 0; i < requests; i++ {
+		record := <-collector
+		if record.Error != nil {
+			t.Fatalf("tls handshake failed: %s", record.Error)
+		}
+		records = append(records, record)
+	}
+	close(context.stop)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected handshakes not to wait for the server to close, took %s", elapsed)
+	}
+	if !records[1].resumed || !records[2].resumed {
+		t.Fatalf("expected the tickets to be received, got resumed %v %v", records[1].resumed, records[2].resumed)
+	}
+}
+
+func TestValidateResumeMode(t *testing.T) {
+	for _, mode := range []string{ResumeNone, ResumeTicket, ResumeCache} {
+		if err := validateResumeMode(mode); err != nil {
+			t.Errorf("expected %s to be valid: %s", mode, err)
+		}
+	}
+
+	if err := validateResumeMode("session-id"); err == nil {
+		t.Error("expected error for unsupported mode")
+	}
+}
@@ -0,0 +1,263 @@
+package gb
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	// HistogramResolution is the smallest duration told apart by histograms.
+	HistogramResolution = time.Microsecond
+	// HistogramHighest is the largest duration recorded, longer ones are
+	// recorded as it.
+	HistogramHighest = time.Hour
+	// HistogramSignificantFigures is the number of significant decimal digits
+	// kept of recorded durations.
+	HistogramSignificantFigures = 3
+)
+
+// DefaultPercentiles are the percentiles of response times reported.
+var DefaultPercentiles = []float64{50, 66, 75, 80, 90, 95, 98, 99}
+
+// Histogram is a HDR histogram of durations. Durations are kept in log-linear
+// buckets of fixed memory: every power of two range is split into the same
+// number of linear sub buckets, so the relative error is the same at any
+// magnitude.
+type Histogram struct {
+	highest                     int64
+	significantFigures          int
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int
+	subBucketMask               int64
+	bucketCount                 int
+	counts                      []int64
+
+	totalCount int64
+	sum        int64
+	min        int64
+	max        int64
+}
+
+// NewHistogram creates a histogram of durations between HistogramResolution
+// and highest with significantFigures (1 to 5) decimal digits of precision.
+func NewHistogram(highest time.Duration, significantFigures int) *Histogram {
+	if significantFigures < 1 || significantFigures > 5 {
+		panic("significant figures must be between 1 and 5")
+	}
+
+	h := &Histogram{
+		highest:            int64(highest / HistogramResolution),
+		significantFigures: significantFigures,
+		min:                math.MaxInt64,
+	}
+
+	largestSingleUnitResolution := 2 * int64(math.Pow10(significantFigures))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestSingleUnitResolution))))
+	h.subBucketHalfCountMagnitude = subBucketCountMagnitude - 1
+	subBucketCount := int64(1) << subBucketCountMagnitude
+	h.subBucketHalfCount = int(subBucketCount / 2)
+	h.subBucketMask = subBucketCount - 1
+
+	// buckets needed to cover highest, each one doubles the range
+	smallestUntrackable := subBucketCount
+	h.bucketCount = 1
+	for smallestUntrackable <= h.highest {
+		smallestUntrackable <<= 1
+		h.bucketCount++
+	}
+
+	h.counts = make([]int64, (h.bucketCount+1)*h.subBucketHalfCount)
+	return h
+}
+
+func newResponseTimeHistogram() *Histogram {
+	return NewHistogram(HistogramHighest, HistogramSignificantFigures)
+}
+
+// Record adds d to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordN(d, 1)
+}
+
+// RecordN adds d n times to the histogram.
+func (h *Histogram) RecordN(d time.Duration, n int64) {
+	v := int64(d / HistogramResolution)
+	if v < 0 {
+		v = 0
+	} else if v > h.highest {
+		v = h.highest
+	}
+
+	h.add(v, n)
+	h.sum += v * n
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+// Merge adds all of durations recorded by other to the histogram, the
+// histograms may differ in range and precision.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.totalCount == 0 {
+		return
+	}
+
+	for i, n := range other.counts {
+		if n > 0 {
+			h.add(min(other.valueAt(i), h.highest), n)
+		}
+	}
+	h.sum += other.sum
+	h.min = min(h.min, other.min)
+	h.max = max(h.max, min(other.max, h.highest))
+}
+
+func (h *Histogram) add(v int64, n int64) {
+	h.counts[h.index(v)] += n
+	h.totalCount += n
+}
+
+// Reset removes all of recorded durations.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.totalCount = 0
+	h.sum = 0
+	h.min = math.MaxInt64
+	h.max = 0
+}
+
+func (h *Histogram) TotalCount() int64 {
+	return h.totalCount
+}
+
+func (h *Histogram) Min() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * HistogramResolution
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * HistogramResolution
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.totalCount) * HistogramResolution
+}
+
+// StdDev is the standard deviation of recorded durations.
+func (h *Histogram) StdDev() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	mean := float64(h.sum) / float64(h.totalCount)
+	var sumOfSquares float64
+	for i, n := range h.counts {
+		if n > 0 {
+			sumOfSquares += math.Pow(float64(h.valueAt(i))-mean, 2) * float64(n)
+		}
+	}
+	return time.Duration(math.Sqrt(sumOfSquares/float64(h.totalCount)) * float64(HistogramResolution))
+}
+
+// Percentile returns the duration which percentile (0 to 100) percent of
+// recorded durations are less than or equal to.
+func (h *Histogram) Percentile(percentile float64) time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	countAtPercentile := int64(math.Ceil(math.Min(percentile, 100) / 100 * float64(h.totalCount)))
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+
+	var total int64
+	for i, n := range h.counts {
+		total += n
+		if total >= countAtPercentile {
+			v := h.highestEquivalentValue(h.valueAt(i))
+			return time.Duration(min(max(v, h.min), h.max)) * HistogramResolution
+		}
+	}
+	return h.Max()
+}
+
+// CountAtOrBelow is the number of recorded durations less than or equal to d,
+// durations recorded in the same bucket as d are counted. Durations longer
+// than the highest trackable one are recorded as it, so the bucket of the
+// highest duration is never counted when d reaches it.
+func (h *Histogram) CountAtOrBelow(d time.Duration) int64 {
+	v := max(int64(d/HistogramResolution), 0)
+	last := h.index(min(v, h.highest))
+	if v >= h.highest {
+		last--
+	}
+
+	var total int64
+	for _, n := range h.counts[:last+1] {
+		total += n
+	}
+	return total
+}
+
+func (h *Histogram) index(v int64) int {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := int(v >> uint(bucketIdx))
+	return (bucketIdx+1)<<h.subBucketHalfCountMagnitude + subBucketIdx - h.subBucketHalfCount
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	pow2Ceiling := bits.Len64(uint64(v | h.subBucketMask))
+	return pow2Ceiling - int(h.subBucketHalfCountMagnitude+1)
+}
+
+// valueAt is the lowest value counted at index i of counts.
+func (h *Histogram) valueAt(i int) int64 {
+	bucketIdx := (i >> h.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := (i & (h.subBucketHalfCount - 1)) + h.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= h.subBucketHalfCount
+		bucketIdx = 0
+	}
+	return int64(subBucketIdx) << uint(bucketIdx)
+}
+
+func (h *Histogram) highestEquivalentValue(v int64) int64 {
+	return v + int64(1)<<uint(h.bucketIndex(v)) - 1
+}
+
+// parsePercentiles parses comma separated percentiles, eg. '50,99,99.9'.
+func parsePercentiles(s string) ([]float64, error) {
+	var percentiles []float64
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(item, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, errors.New("invalid percentile: " + item)
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, nil
+}
+
+func formatPercentiles(percentiles []float64) string {
+	items := make([]string, len(percentiles))
+	for i, p := range percentiles {
+		items[i] = strconv.FormatFloat(p, 'f', -1, 64)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,99 @@
+package gb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := newResponseTimeHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	if h.TotalCount() != 10000 || h.Min() != time.Microsecond || h.Max() != 10*time.Millisecond {
+		t.Fatalf("unexpected count %d, min %s and max %s", h.TotalCount(), h.Min(), h.Max())
+	}
+
+	for percentile, expected := range map[float64]time.Duration{
+		50:     5000 * time.Microsecond,
+		99:     9900 * time.Microsecond,
+		99.9:   9990 * time.Microsecond,
+		99.99:  9999 * time.Microsecond,
+		100:    10000 * time.Microsecond,
+		0.0001: time.Microsecond,
+	} {
+		actual := h.Percentile(percentile)
+		// 3 significant figures
+		if diff := actual - expected; diff < 0 || diff > expected/1000 {
+			t.Errorf("expected p%v of %s, got %s", percentile, expected, actual)
+		}
+	}
+
+	// sub millisecond durations are exact
+	h.Reset()
+	h.Record(1234 * time.Microsecond)
+	if actual := h.Percentile(50); actual != 1234*time.Microsecond {
+		t.Errorf("expected 1.234ms, got %s", actual)
+	}
+}
+
+func TestHistogramRange(t *testing.T) {
+	h := NewHistogram(time.Second, 2)
+	h.Record(-time.Millisecond)
+	h.Record(time.Minute)
+
+	if h.Min() != 0 || h.Max() != time.Second {
+		t.Fatalf("expected durations clamped to 0 and 1s, got %s and %s", h.Min(), h.Max())
+	}
+	if len(h.counts) > 2000 {
+		t.Fatalf("expected fixed memory of a few buckets, got %d counts", len(h.counts))
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	first := newResponseTimeHistogram()
+	second := NewHistogram(time.Minute, 2)
+	for i := 1; i <= 100; i++ {
+		first.Record(time.Duration(i) * time.Millisecond)
+		second.Record(time.Duration(i+100) * time.Millisecond)
+	}
+
+	first.Merge(second)
+	first.Merge(nil)
+	if first.TotalCount() != 200 || first.Min() != time.Millisecond || first.Max() != 200*time.Millisecond {
+		t.Fatalf("unexpected count %d, min %s and max %s", first.TotalCount(), first.Min(), first.Max())
+	}
+	if mean := first.Mean(); mean != 100500*time.Microsecond {
+		t.Fatalf("expected exact mean of 100.5ms, got %s", mean)
+	}
+	if p50 := first.Percentile(50); p50 < 100*time.Millisecond || p50 > 101*time.Millisecond {
+		t.Fatalf("expected p50 of 100ms, got %s", p50)
+	}
+}
+
+func TestHistogramCountAtOrBelow(t *testing.T) {
+	h := NewHistogram(time.Second, 3)
+	h.Record(100 * time.Millisecond)
+	h.Record(500 * time.Millisecond)
+	h.Record(5 * time.Second) // recorded as 1s
+
+	for d, expected := range map[time.Duration]int64{0: 0, 100 * time.Millisecond: 1, 999 * time.Millisecond: 2, time.Second: 2, time.Hour: 2} {
+		if count := h.CountAtOrBelow(d); count != expected {
+			t.Errorf("expected %d durations at or below %s, got %d", expected, d, count)
+		}
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	percentiles, err := parsePercentiles("50, 99.9,99.99")
+	if err != nil || formatPercentiles(percentiles) != "50,99.9,99.99" {
+		t.Fatalf("unexpected percentiles %v (%v)", percentiles, err)
+	}
+
+	for _, s := range []string{"0", "101", "p99"} {
+		if _, err := parsePercentiles(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -2,14 +2,17 @@ package gb
 
 import (
 	"bytes"
-	"crypto/tls"
 	//	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	//	"runtime/pprof"
@@ -24,7 +27,7 @@ var (
 )
 
 func SetRatelimit(rate int64) *tb.Bucket {
-	fmt.Println("SetRatelimit: --- : ", rate)
+	fmt.Fprintln(os.Stderr, "SetRatelimit: --- : ", rate)
 	freq = time.Duration(1e9 / rate)
 	bucket = tb.NewBucket(rate, freq)
 	return bucket
@@ -57,16 +60,27 @@ type CustomRequest interface {
 	HandleResult(wk *HTTPWorker, response *http.Response) (n int64, err error)
 }
 
+// HTTPJob is a request queued on the jobs channel of HTTP workers.
+type HTTPJob struct {
+	request *http.Request
+	queued  time.Time
+}
+
+// NewHTTPJob stamps request with the time it is queued.
+func NewHTTPJob(request *http.Request) *HTTPJob {
+	return &HTTPJob{request, time.Now()}
+}
+
 type HTTPWorker struct {
 	c         *Context
 	client    *http.Client
-	jobs      chan *http.Request
+	jobs      chan *HTTPJob
 	collector chan *Record
 	discard   io.ReaderFrom
 	Custom    CustomRequest
 }
 
-func NewHTTPWorker(context *Context, jobs chan *http.Request, collector chan *Record) *HTTPWorker {
+func NewHTTPWorker(context *Context, jobs chan *HTTPJob, collector chan *Record) *HTTPWorker {
 
 	var buf []byte
 	contentSize := context.GetInt(FieldContentSize)
@@ -78,7 +92,7 @@ func NewHTTPWorker(context *Context, jobs chan *http.Request, collector chan *Re
 
 	return &HTTPWorker{
 		context,
-		NewClient(context.config),
+		newPooledClient(context),
 		jobs,
 		collector,
 		&Discard{buf},
@@ -101,25 +115,84 @@ func (h *HTTPWorker) Run(i int) {
 
 	timer := time.NewTimer(h.c.config.executionTimeout)
 	var count int = 0
-	for job := range h.jobs {
-
+	var connRequests int // requests sent on the connection of the worker
+	for {
 		TakeRatelimitToken(i)
+		ready := time.Now()
+		queued, ok := <-h.jobs
+		if !ok {
+			break
+		}
+		job := queued.request
+
+		// the job waits in the queue from being queued until it is sent, but
+		// not before the worker is ready, past its rate limit: the jobs queued
+		// ahead of the run wait for the server to answer the earlier ones
+		since := queued.queued
+		if since.Before(ready) {
+			since = ready
+		}
+
 		count++
 		timer.Reset(h.c.config.executionTimeout)
-		asyncResult := h.send(job)
+
+		var remoteAddr string
+		if h.c.config.resolver != nil {
+			job = traceRemoteAddr(job, &remoteAddr)
+		}
+		proxyConnect := new(int64)
+		if h.c.config.proxy != nil {
+			job = traceProxyConnect(job, proxyConnect)
+		}
+		var use connUse
+		job = traceConnUse(job, &use)
+		job = traceRedirect(job, &redirectTrace{})
+		encoded, _ := job.Body.(encodeTimer)
+		var upload *countingReader
+		if job.Body != nil && job.Body != http.NoBody {
+			upload = &countingReader{ReadCloser: job.Body}
+			job.Body = upload
+		}
+		// the pool of the worker keeps the one connection of its last request
+		if pool := h.c.config.pool; pool != nil && pool.RequestsPerConn > 0 && connRequests+1 >= pool.RequestsPerConn {
+			job.Close = true
+		}
+		h.c.BeginRequest()
+		asyncResult := h.send(job, since)
 
 		select {
 		case record := <-asyncResult:
+			h.c.EndRequest()
+			record.remoteAddr = remoteAddr
+			record.proxyConnect = time.Duration(atomic.LoadInt64(proxyConnect))
+			record.conn = use
+			switch use {
+			case connNew:
+				connRequests = 1
+			case connReused:
+				connRequests++
+			}
+			if job.Close {
+				connRequests = 0
+			}
+			if upload != nil {
+				record.uploadSize = upload.Count()
+			}
+			if encoded != nil {
+				record.encodeTime = encoded.encodeTime()
+			}
 			if !h.c.config.skipFirst || count > 1 {
 				h.collector <- record
 			}
 
 		case <-timer.C:
+			h.c.EndRequest()
+			connRequests = 0
 			h.collector <- &Record{Error: &ResponseTimeoutError{errors.New("execution timeout")}}
-			h.client.Transport.(*http.Transport).CancelRequest(job)
+			cancelRequest(h.client, job)
 
 		case <-h.c.stop:
-			h.client.Transport.(*http.Transport).CancelRequest(job)
+			cancelRequest(h.client, job)
 			timer.Stop()
 			return
 		}
@@ -127,11 +200,13 @@ func (h *HTTPWorker) Run(i int) {
 	timer.Stop()
 }
 
-func (h *HTTPWorker) send(request *http.Request) (asyncResult chan *Record) {
+// send sends request in a goroutine, the queueing delay of the request
+// since queued ends when it is started.
+func (h *HTTPWorker) send(request *http.Request, queued time.Time) (asyncResult chan *Record) {
 
 	asyncResult = make(chan *Record, 1)
 	go func() {
-		record := &Record{}
+		record := &Record{queueDelay: time.Since(queued)}
 		sw := &StopWatch{}
 		sw.Start()
 
@@ -141,9 +216,10 @@ func (h *HTTPWorker) send(request *http.Request) (asyncResult chan *Record) {
 		defer func() {
 			sw.Stop()
 			record.responseTime = sw.Elapsed
+			updateRedirect(record, request, sw.start, h.c.config.redirect.excludeTime())
 
 			if r := recover(); r != nil {
-				fmt.Printf("err recovered %s \n\n", errors.Wrap(r, 2).ErrorStack())
+				fmt.Fprintf(os.Stderr, "err recovered %s \n\n", errors.Wrap(r, 2).ErrorStack())
 
 				if Err, ok := r.(error); ok {
 					record.Error = Err
@@ -173,13 +249,27 @@ func (h *HTTPWorker) send(request *http.Request) (asyncResult chan *Record) {
 			resp, err = h.client.Do(request)
 			retry = retry - 1
 			if err != nil {
+				var authErr *AuthError
+				if errors.As(err, &authErr) {
+					record.Error = authErr
+					return
+				}
+				var redirectErr *RedirectError
+				if errors.As(err, &redirectErr) {
+					record.Error = redirectErr
+					return
+				}
 				if retry <= 0 {
 					time.Sleep(time.Second)
-					record.Error = &ConnectError{err}
-					fmt.Println(" ......stop retry...." + err.Error())
+					if isPortExhausted(err) {
+						record.Error = &PortExhaustedError{err}
+					} else {
+						record.Error = &ConnectError{err}
+					}
+					fmt.Fprintln(os.Stderr, " ......stop retry...."+err.Error())
 					return
 				} else {
-					fmt.Println(" ......retry...." + err.Error())
+					fmt.Fprintln(os.Stderr, " ......retry...."+err.Error())
 				}
 			} else {
 				break
@@ -188,18 +278,35 @@ func (h *HTTPWorker) send(request *http.Request) (asyncResult chan *Record) {
 
 		defer resp.Body.Close()
 
+		wire := &countingReader{ReadCloser: resp.Body}
+		resp.Body = wire
+		var decoder *lazyDecoder
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && hasContent(resp) {
+			d := decoderPool.Get().(*decoders)
+			defer decoderPool.Put(d)
+			decoder = d.decodeLazily(encoding, wire)
+			resp.Body = ioutil.NopCloser(decoder)
+		}
+		defer func() {
+			record.wireSize = wire.Count()
+			if decoder != nil {
+				record.decodeTime = decoder.decodeTime()
+			}
+		}()
+
 		if h.Custom != nil {
 			contentSize, err = h.Custom.HandleResult(h, resp)
 		} else {
 			contentSize, err = h.discard.ReadFrom(resp.Body)
 		}
 
-		if resp.StatusCode < 200 || resp.StatusCode > 300 {
+		record.statusCode = resp.StatusCode
+		if !h.c.config.successCodes.Match(resp.StatusCode) {
 			record.Error = &ResponseError{errors.Errorf("Response is %d", resp.StatusCode)}
 			//record.Error = &ResponseError{err}
 			//return
 		} else if err != nil {
-			fmt.Printf("err in read: %s\n", err.Error())
+			fmt.Fprintf(os.Stderr, "err in read: %s\n", err.Error())
 			if err == io.ErrUnexpectedEOF {
 				record.Error = &LengthError{ErrInvalidContnetSize}
 				//return
@@ -213,6 +320,17 @@ func (h *HTTPWorker) send(request *http.Request) (asyncResult chan *Record) {
 	return asyncResult
 }
 
+// traceRemoteAddr stores the address of the connection used by request
+// into addr.
+func traceRemoteAddr(request *http.Request, addr *string) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*addr = info.Conn.RemoteAddr().String()
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
 type Discard struct {
 	blackHole []byte
 }
@@ -237,7 +355,7 @@ func (d *Discard) GetBuffer() []byte {
 func DetectHost(context *Context) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("err recovered %s \n\n", errors.Wrap(r, 2).ErrorStack())
+			fmt.Fprintf(os.Stderr, "err recovered %s \n\n", errors.Wrap(r, 2).ErrorStack())
 			TraceException(r)
 		}
 	}()
@@ -255,12 +373,25 @@ func DetectHost(context *Context) (err error) {
 	}
 
 	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
+	var reader io.Reader = resp.Body
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding != "" && hasContent(resp) {
+		reader = (&decoders{}).decodeLazily(encoding, resp.Body)
+	}
+	body, readErr := ioutil.ReadAll(reader)
+	if readErr != nil && reader != io.Reader(resp.Body) {
+		// the body is not encoded as it claims
+		err = readErr
+		return
+	}
 
 	context.SetString(FieldServerName, resp.Header.Get("Server"))
+	if resp.TLS != nil {
+		context.SetValue(FieldTLSState, resp.TLS)
+	}
 	headerContentSize := resp.Header.Get("Content-Length")
 
-	if headerContentSize != "" {
+	if headerContentSize != "" && encoding == "" {
 		contentSize, _ := strconv.Atoi(headerContentSize)
 		context.SetInt(FieldContentSize, contentSize)
 	} else {
@@ -272,25 +403,39 @@ func DetectHost(context *Context) (err error) {
 
 func NewClient(config *Config) *http.Client {
 
-	// skip certification check for self-signed certificates
-	tlsconfig := &tls.Config{
-		InsecureSkipVerify: true,
-	}
+	tlsconfig := newClientTLSConfig(config)
 
-	// TODO: tcp options
 	// TODO: monitor tcp metrics
 	transport := &http.Transport{
-		DisableCompression:  !config.gzip,
+		DisableCompression:  true,
 		DisableKeepAlives:   !config.keepAlive,
 		TLSClientConfig:     tlsconfig,
 		MaxIdleConnsPerHost: config.concurrency * 2,
+		DialContext:         NewDialer(config),
+	}
+
+	if config.pool != nil {
+		transport.MaxConnsPerHost = config.pool.MaxConnsPerHost
+		transport.IdleConnTimeout = config.pool.IdleTimeout
+	}
+
+	if config.proxy != nil {
+		if URL, err := url.Parse(config.url); err == nil && !config.proxy.Tunnel(URL.Scheme) {
+			transport.Proxy = http.ProxyURL(config.proxy.forwardURL())
+		}
 	}
 
-	if config.proxyURL != nil {
-		transport.Proxy = http.ProxyURL(config.proxyURL)
+	client := &http.Client{Transport: transport, CheckRedirect: config.redirect.checkRedirect}
+	if config.auth != nil {
+		client.Transport = &authTransport{transport: transport, auth: config.auth}
 	}
+	return client
+}
 
-	return &http.Client{Transport: transport}
+func cancelRequest(client *http.Client, request *http.Request) {
+	if canceler, ok := client.Transport.(interface{ CancelRequest(*http.Request) }); ok {
+		canceler.CancelRequest(request)
+	}
 }
 func simpleNewHTTPRequest(config *Config) (request *http.Request, err error) {
 	return nil, nil
@@ -298,8 +443,14 @@ func simpleNewHTTPRequest(config *Config) (request *http.Request, err error) {
 func NewHTTPRequest(config *Config) (request *http.Request, err error) {
 
 	var body io.Reader
-
-	if config.method == "POST" || config.method == "PUT" {
+	var length int64
+
+	if config.body != nil {
+		body, length = newGeneratedBody(config)
+	} else if config.form != nil && config.form.Vary {
+		content, _ := newFormBody(config)
+		body = bytes.NewReader(content)
+	} else if config.method == "POST" || config.method == "PUT" {
 		body = bytes.NewReader(config.bodyContent)
 	}
 
@@ -309,9 +460,18 @@ func NewHTTPRequest(config *Config) (request *http.Request, err error) {
 		return
 	}
 
-	fmt.Println("Content-Type", config.contentType)
+	if config.body != nil {
+		setBodyLength(request, length)
+	}
+
 	request.Header.Set("Content-Type", config.contentType)
 	request.Header.Set("User-Agent", config.userAgent)
+	if config.gzip {
+		request.Header.Set("Accept-Encoding", strings.Join(config.acceptEncodings, ", "))
+	}
+	if config.bodyEncoding != "" {
+		request.Header.Set("Content-Encoding", config.bodyEncoding)
+	}
 
 	if config.keepAlive {
 		request.Header.Set("Connection", "keep-alive")
@@ -329,7 +489,10 @@ func NewHTTPRequest(config *Config) (request *http.Request, err error) {
 	}
 
 	if config.basicAuthentication != "" {
-		pair := strings.Split(config.basicAuthentication, ":")
+		pair := strings.SplitN(config.basicAuthentication, ":", 2)
+		if len(pair) != 2 {
+			return nil, errors.New("basic authentication must be username:password")
+		}
 		request.SetBasicAuth(pair[0], pair[1])
 	}
 
@@ -338,12 +501,55 @@ func NewHTTPRequest(config *Config) (request *http.Request, err error) {
 
 func simpleCopyHTTPRequest(config *Config, request *http.Request) *http.Request {
 	newRequest := *request
-	if request.Body != nil {
+	if config.body != nil {
+		body, length := newGeneratedBody(config)
+		newRequest.Body = body
+		setBodyLength(&newRequest, length)
+	} else if config.form != nil && config.form.Vary {
+		content, encodeTime := newFormBody(config)
+		newRequest.Body = ioutil.NopCloser(bytes.NewReader(content))
+		if encodeTime > 0 {
+			newRequest.Body = &encodedBody{newRequest.Body, encodeTime}
+		}
+		newRequest.ContentLength = int64(len(content))
+		newRequest.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(content)), nil
+		}
+	} else if request.Body != nil {
 		newRequest.Body = ioutil.NopCloser(bytes.NewReader(config.bodyContent))
 	}
 	return &newRequest
 }
 
+func newGeneratedBody(config *Config) (io.ReadCloser, int64) {
+	body, length := config.body.NewReader()
+	if config.bodyEncoding != "" {
+		return compressReader(config.bodyEncoding, body), -1
+	}
+	return body, length
+}
+
+// newFormBody builds a form body, encoded in encodeTime.
+func newFormBody(config *Config) (content []byte, encodeTime time.Duration) {
+	content = config.form.Build()
+	if config.bodyEncoding != "" {
+		// the encoding is validated and writes to memory never fail
+		start := time.Now()
+		content, _ = compressBytes(config.bodyEncoding, content)
+		encodeTime = time.Since(start)
+	}
+	return
+}
+
+// setBodyLength sets the length of a generated body, -1 sends it chunked.
+func setBodyLength(request *http.Request, length int64) {
+	request.ContentLength = length
+	request.GetBody = nil
+	if length == 0 {
+		request.Body = http.NoBody
+	}
+}
+
 func CopyHTTPRequest(config *Config, request *http.Request) *http.Request {
 
 	return simpleCopyHTTPRequest(config, request)
@@ -357,6 +563,10 @@ func (e *LengthError) Error() string {
 	return e.err.Error()
 }
 
+func (e *LengthError) Unwrap() error {
+	return e.err
+}
+
 type ConnectError struct {
 	err error
 }
@@ -365,6 +575,36 @@ func (e *ConnectError) Error() string {
 	return e.err.Error()
 }
 
+func (e *ConnectError) Unwrap() error {
+	return e.err
+}
+
+// PortExhaustedError is a connect error caused by running out of local
+// address and port pairs (EADDRNOTAVAIL).
+type PortExhaustedError struct {
+	err error
+}
+
+func (e *PortExhaustedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *PortExhaustedError) Unwrap() error {
+	return e.err
+}
+
+type AuthError struct {
+	err error
+}
+
+func (e *AuthError) Error() string {
+	return e.err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.err
+}
+
 type ReceiveError struct {
 	err error
 }
@@ -373,6 +613,10 @@ func (e *ReceiveError) Error() string {
 	return e.err.Error()
 }
 
+func (e *ReceiveError) Unwrap() error {
+	return e.err
+}
+
 type ExceptionError struct {
 	err error
 }
@@ -381,6 +625,10 @@ func (e *ExceptionError) Error() string {
 	return e.err.Error()
 }
 
+func (e *ExceptionError) Unwrap() error {
+	return e.err
+}
+
 type ResponseError struct {
 	err error
 }
@@ -389,6 +637,22 @@ func (e *ResponseError) Error() string {
 	return e.err.Error()
 }
 
+func (e *ResponseError) Unwrap() error {
+	return e.err
+}
+
+type RedirectError struct {
+	err error
+}
+
+func (e *RedirectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RedirectError) Unwrap() error {
+	return e.err
+}
+
 type ResponseTimeoutError struct {
 	err error
 }
@@ -396,3 +660,7 @@ type ResponseTimeoutError struct {
 func (e *ResponseTimeoutError) Error() string {
 	return e.err.Error()
 }
+
+func (e *ResponseTimeoutError) Unwrap() error {
+	return e.err
+}
@@ -2,8 +2,12 @@ package gb
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -46,7 +50,7 @@ func TestHTTPWithGet(t *testing.T) {
 
 	context := NewContext(config)
 	context.SetInt(FieldContentSize, len(responseStr))
-	jobs := make(chan *http.Request)
+	jobs := make(chan *HTTPJob)
 	collector := make(chan *Record)
 
 	worker := NewHTTPWorker(context, jobs, collector)
@@ -58,7 +62,7 @@ func TestHTTPWithGet(t *testing.T) {
 		t.Fatalf("new http request failed: %s", err)
 	}
 
-	jobs <- request
+	jobs <- NewHTTPJob(request)
 	record := <-collector
 	close(jobs)
 	close(context.stop)
@@ -99,7 +103,7 @@ func TestHTTPWithPost(t *testing.T) {
 
 	context := NewContext(config)
 	context.SetInt(FieldContentSize, len(responseStr))
-	jobs := make(chan *http.Request)
+	jobs := make(chan *HTTPJob)
 	collector := make(chan *Record)
 
 	worker := NewHTTPWorker(context, jobs, collector)
@@ -112,7 +116,7 @@ func TestHTTPWithPost(t *testing.T) {
 		t.Fatalf("new http request failed: %s", err)
 	}
 
-	jobs <- request
+	jobs <- NewHTTPJob(request)
 	record := <-collector
 	close(jobs)
 	close(context.stop)
@@ -149,7 +153,7 @@ func TestHTTPWorkerWithTimeout(t *testing.T) {
 
 	context := NewContext(config)
 	context.SetInt(FieldContentSize, len(responseStr))
-	jobs := make(chan *http.Request)
+	jobs := make(chan *HTTPJob)
 	collector := make(chan *Record)
 
 	worker := NewHTTPWorker(context, jobs, collector)
@@ -161,7 +165,7 @@ func TestHTTPWorkerWithTimeout(t *testing.T) {
 		t.Fatalf("new http request failed: %s", err)
 	}
 
-	jobs <- request
+	jobs <- NewHTTPJob(request)
 	record := <-collector
 	close(jobs)
 	close(context.stop)
@@ -173,6 +177,92 @@ func TestHTTPWorkerWithTimeout(t *testing.T) {
 	}
 }
 
+func TestHTTPWithUnixSocket(t *testing.T) {
+
+	//fake http server on unix domain socket
+	responseStr := "hello"
+
+	dir, err := ioutil.TempDir("", "gbtest")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "app.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen on unix socket failed: %s", err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/x" {
+			w.Write([]byte(responseStr))
+		}
+	}))
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	// http worker
+
+	config := &Config{
+		concurrency:      1,
+		requests:         1,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              "http://localhost/api/x",
+		unixSocket:       socket,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+
+	go worker.Run(0)
+
+	request, err := NewHTTPRequest(config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+
+	jobs <- NewHTTPJob(request)
+	record := <-collector
+	close(jobs)
+	close(context.stop)
+
+	if record.Error != nil {
+		t.Fatalf("sent a http reqeust but was error: %s", record.Error)
+	}
+
+	if record.contentSize != int64(len(responseStr)) {
+		t.Fatalf("send a http reqeust but content size dismatch")
+	}
+}
+
+func TestTraceRemoteAddr(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	request, _ := http.NewRequest("GET", ts.URL, nil)
+
+	var remoteAddr string
+	resp, err := http.DefaultClient.Do(traceRemoteAddr(request, &remoteAddr))
+	if err != nil {
+		t.Fatalf("send http request failed: %s", err)
+	}
+	resp.Body.Close()
+
+	if remoteAddr != ts.Listener.Addr().String() {
+		t.Fatalf("expected remote address %s, got %s", ts.Listener.Addr(), remoteAddr)
+	}
+}
+
 func BenchmarkNewHTTPRequestWithGet(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,379 @@
+package gb
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONReportVersion is the version of the JSON report schema. It is bumped
+// when fields are renamed, removed or change their meaning, new fields may be
+// added within a version.
+const JSONReportVersion = 1
+
+// JSONReport is the machine-readable report of a run. Times of requests are
+// in milliseconds and times of the run in seconds whatever the unit of the
+// text report.
+type JSONReport struct {
+	SchemaVersion int            `json:"schema_version"`
+	Run           JSONRun        `json:"run"`
+	Config        JSONConfig     `json:"config"`
+	Server        JSONServer     `json:"server"`
+	Totals        JSONTotals     `json:"totals"`
+	Errors        JSONErrors     `json:"errors"`
+	StatusCodes   map[string]int `json:"status_codes,omitempty"`
+	GRPCCodes     map[string]int `json:"grpc_codes,omitempty"`
+	Latency       *JSONLatency   `json:"latency,omitempty"`
+	Apdex         *JSONApdex     `json:"apdex,omitempty"`
+	SLO           []JSONSLO      `json:"slo,omitempty"`
+	Intervals     []JSONInterval `json:"intervals,omitempty"`
+}
+
+type JSONRun struct {
+	Start     time.Time `json:"start"`
+	GBVersion string    `json:"gb_version"`
+	GoVersion string    `json:"go_version"`
+	Host      string    `json:"host"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	CPUs      int       `json:"cpus"`
+}
+
+type JSONConfig struct {
+	URL              string    `json:"url"`
+	Method           string    `json:"method,omitempty"`
+	GRPCMethod       string    `json:"grpc_method,omitempty"`
+	UnixSocket       string    `json:"unix_socket,omitempty"`
+	Requests         int       `json:"requests"`
+	Concurrency      int       `json:"concurrency"`
+	TimeLimitSeconds int       `json:"time_limit_seconds,omitempty"`
+	TimeoutSeconds   float64   `json:"timeout_seconds,omitempty"`
+	KeepAlive        bool      `json:"keep_alive"`
+	AcceptEncodings  []string  `json:"accept_encodings,omitempty"`
+	ContentType      string    `json:"content_type,omitempty"`
+	Headers          []string  `json:"headers,omitempty"`
+	Auth             string    `json:"auth,omitempty"`
+	Proxy            string    `json:"proxy,omitempty"`
+	RawHTTP          bool      `json:"raw_http,omitempty"`
+	Pipeline         int       `json:"pipeline,omitempty"`
+	SuccessCodes     string    `json:"success_codes,omitempty"`
+	MaxRedirects     int       `json:"max_redirects"`
+	Percentiles      []float64 `json:"percentiles"`
+	IntervalSeconds  float64   `json:"interval_seconds,omitempty"`
+	ApdexTMillis     float64   `json:"apdex_t_ms,omitempty"`
+	SLOTargetsMillis []float64 `json:"slo_targets_ms,omitempty"`
+}
+
+type JSONServer struct {
+	Software       string   `json:"software"`
+	Hostname       string   `json:"hostname,omitempty"`
+	Port           int      `json:"port,omitempty"`
+	DocumentPath   string   `json:"document_path,omitempty"`
+	DocumentLength int      `json:"document_length"`
+	TLS            *JSONTLS `json:"tls,omitempty"`
+}
+
+type JSONTLS struct {
+	Protocol   string `json:"protocol"`
+	Cipher     string `json:"cipher"`
+	ServerName string `json:"server_name,omitempty"`
+}
+
+type JSONTotals struct {
+	DurationSeconds   float64 `json:"duration_seconds"`
+	Requests          int     `json:"requests"`
+	Success           int     `json:"success"`
+	Failed            int     `json:"failed"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	ReceivedBytes     int64   `json:"received_bytes"`
+	WireBytes         int64   `json:"wire_bytes,omitempty"`
+	SentBytes         int64   `json:"sent_bytes,omitempty"`
+	EncodeMillis      float64 `json:"encode_ms,omitempty"` // total time of compressing request bodies
+	DecodeMillis      float64 `json:"decode_ms,omitempty"` // total time of decoding responses
+}
+
+type JSONErrors struct {
+	Connect       int             `json:"connect"`
+	Receive       int             `json:"receive"`
+	Response      int             `json:"response"`
+	Length        int             `json:"length"`
+	Timeout       int             `json:"timeout"`
+	Exception     int             `json:"exception"`
+	PortExhausted int             `json:"port_exhausted"`
+	Kinds         []JSONErrorKind `json:"kinds,omitempty"`
+}
+
+type JSONErrorKind struct {
+	Kind     string             `json:"kind"`
+	Count    int                `json:"count"`
+	Messages []JSONErrorMessage `json:"messages"`
+}
+
+type JSONErrorMessage struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+type JSONLatency struct {
+	MinMillis    float64          `json:"min_ms"`
+	MeanMillis   float64          `json:"mean_ms"`
+	StdDevMillis float64          `json:"stddev_ms"`
+	MedianMillis float64          `json:"median_ms"`
+	MaxMillis    float64          `json:"max_ms"`
+	Percentiles  []JSONPercentile `json:"percentiles"`
+}
+
+type JSONPercentile struct {
+	Percentile float64 `json:"percentile"`
+	Millis     float64 `json:"ms"`
+}
+
+type JSONApdex struct {
+	TMillis    float64 `json:"t_ms"`
+	Score      float64 `json:"score"`
+	Rating     string  `json:"rating"`
+	Satisfied  int64   `json:"satisfied"`
+	Tolerating int64   `json:"tolerating"`
+	Frustrated int64   `json:"frustrated"`
+}
+
+type JSONSLO struct {
+	TargetMillis float64 `json:"target_ms"`
+	Within       int64   `json:"within"`
+	Total        int64   `json:"total"`
+	Percent      float64 `json:"percent"`
+}
+
+type JSONInterval struct {
+	ElapsedSeconds    float64            `json:"elapsed_seconds"`
+	DurationSeconds   float64            `json:"duration_seconds"`
+	Requests          int                `json:"requests"`
+	Errors            int                `json:"errors"`
+	ReceivedBytes     int64              `json:"received_bytes"`
+	RequestsPerSecond float64            `json:"requests_per_second"`
+	ErrorRate         float64            `json:"error_rate"`
+	P50Millis         float64            `json:"p50_ms"`
+	P90Millis         float64            `json:"p90_ms"`
+	P99Millis         float64            `json:"p99_ms"`
+	InFlight          int64              `json:"in_flight"`
+	Server            map[string]float64 `json:"server,omitempty"`
+}
+
+// sensitiveHeaders are the headers whose values are left out of the report.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+func NewJSONReport(context *Context, stats *Stats) *JSONReport {
+	config := context.config
+	report := &JSONReport{SchemaVersion: JSONReportVersion}
+
+	host, _ := os.Hostname()
+	report.Run = JSONRun{
+		Start:     stats.start,
+		GBVersion: GBVersion,
+		GoVersion: runtime.Version(),
+		Host:      host,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.GOMAXPROCS(0),
+	}
+
+	percentiles := config.percentiles
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
+	// the url may carry credentials as user:pass@, only the redacted form is
+	// written
+	URL, urlErr := url.Parse(config.url)
+	report.Config = JSONConfig{
+		Method:           config.method,
+		GRPCMethod:       config.grpcMethod,
+		UnixSocket:       config.unixSocket,
+		Requests:         config.requests,
+		Concurrency:      config.concurrency,
+		TimeLimitSeconds: config.timelimit,
+		TimeoutSeconds:   config.executionTimeout.Seconds(),
+		KeepAlive:        config.keepAlive,
+		ContentType:      config.contentType,
+		RawHTTP:          config.rawHTTP,
+		Percentiles:      percentiles,
+		IntervalSeconds:  config.interval.Seconds(),
+		ApdexTMillis:     toMillis(config.apdexT),
+	}
+	if config.gzip {
+		report.Config.AcceptEncodings = config.acceptEncodings
+	}
+	for _, header := range config.headers {
+		report.Config.Headers = append(report.Config.Headers, redactHeader(header))
+	}
+	if urlErr == nil {
+		report.Config.URL = URL.Redacted()
+	}
+	if config.auth != nil {
+		report.Config.Auth = config.auth.String()
+	}
+	if config.proxy != nil {
+		report.Config.Proxy = config.proxy.String()
+	}
+	if config.rawHTTP {
+		report.Config.Pipeline = config.pipeline
+	}
+	if config.successCodes != nil {
+		report.Config.SuccessCodes = config.successCodes.String()
+	}
+	report.Config.MaxRedirects = config.redirect.max()
+	for _, target := range config.sloTargets {
+		report.Config.SLOTargetsMillis = append(report.Config.SLOTargetsMillis, toMillis(target))
+	}
+
+	report.Server.Software, _ = context.GetValue(FieldServerName).(string)
+	report.Server.DocumentLength, _ = context.GetValue(FieldContentSize).(int)
+	if config.unixSocket == "" {
+		report.Server.Hostname = config.host
+		report.Server.Port = config.port
+	}
+	if !config.IsGRPC() && urlErr == nil {
+		report.Server.DocumentPath = URL.RequestURI()
+	}
+	if state, ok := context.GetValue(FieldTLSState).(*tls.ConnectionState); ok {
+		report.Server.TLS = &JSONTLS{tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.ServerName}
+	}
+
+	report.Totals = JSONTotals{
+		DurationSeconds: stats.totalExecutionTime.Seconds(),
+		Requests:        stats.totalRequests,
+		Success:         stats.totalSuccess,
+		Failed:          stats.totalFailedReqeusts,
+		ReceivedBytes:   stats.totalReceived,
+		SentBytes:       stats.totalSent,
+		EncodeMillis:    toMillis(stats.totalEncodeTime),
+		DecodeMillis:    toMillis(stats.totalDecodeTime),
+	}
+	if stats.totalExecutionTime > 0 {
+		report.Totals.RequestsPerSecond = float64(stats.totalRequests) / stats.totalExecutionTime.Seconds()
+	}
+	if stats.totalWire != stats.totalReceived {
+		report.Totals.WireBytes = stats.totalWire
+	}
+
+	report.Errors = JSONErrors{
+		Connect:       stats.errConnect,
+		Receive:       stats.errReceive,
+		Response:      stats.errResponse,
+		Length:        stats.errLength,
+		Timeout:       stats.errTimeout,
+		Exception:     stats.errException,
+		PortExhausted: stats.errPortExhausted,
+	}
+	for _, kind := range sortedKeys(stats.errKinds) {
+		errorKind := JSONErrorKind{Kind: kind, Count: stats.errKinds[kind], Messages: []JSONErrorMessage{}}
+		for _, message := range sortedKeys(stats.errMessages[kind]) {
+			errorKind.Messages = append(errorKind.Messages, JSONErrorMessage{message, stats.errMessages[kind][message]})
+		}
+		report.Errors.Kinds = append(report.Errors.Kinds, errorKind)
+	}
+
+	if len(stats.statusCodes) > 0 {
+		report.StatusCodes = make(map[string]int, len(stats.statusCodes))
+		for code, count := range stats.statusCodes {
+			report.StatusCodes[strconv.Itoa(code)] = count
+		}
+	}
+	if len(stats.grpcCodes) > 0 {
+		report.GRPCCodes = make(map[string]int, len(stats.grpcCodes))
+		for code, count := range stats.grpcCodes {
+			report.GRPCCodes[code.String()] = count
+		}
+	}
+
+	if responseTimes := stats.responseTimes; responseTimes != nil && responseTimes.TotalCount() > 0 {
+		report.Latency = &JSONLatency{
+			MinMillis:    toMillis(responseTimes.Min()),
+			MeanMillis:   toMillis(avg(stats.totalResponseTime, stats.totalSuccess)),
+			StdDevMillis: toMillis(responseTimes.StdDev()),
+			MedianMillis: toMillis(responseTimes.Percentile(50)),
+			MaxMillis:    toMillis(responseTimes.Max()),
+		}
+		for _, percentile := range append(percentiles[:len(percentiles):len(percentiles)], 100) {
+			report.Latency.Percentiles = append(report.Latency.Percentiles, JSONPercentile{percentile, toMillis(responseTimes.Percentile(percentile))})
+		}
+	}
+
+	if stats.totalRequests > 0 && config.apdexT > 0 {
+		apdex := newApdex(config.apdexT, stats)
+		report.Apdex = &JSONApdex{toMillis(apdex.t), apdex.Score(), apdex.Rating(), apdex.satisfied, apdex.tolerating, apdex.frustrated}
+	}
+	if stats.totalRequests > 0 {
+		for _, a := range sloAttainments(config.sloTargets, stats) {
+			report.SLO = append(report.SLO, JSONSLO{toMillis(a.target), a.within, a.total, a.Percent()})
+		}
+	}
+
+	for _, s := range stats.intervals {
+		report.Intervals = append(report.Intervals, JSONInterval{
+			ElapsedSeconds:    s.elapsed.Seconds(),
+			DurationSeconds:   s.duration.Seconds(),
+			Requests:          s.requests,
+			Errors:            s.errors,
+			ReceivedBytes:     s.received,
+			RequestsPerSecond: s.RPS(),
+			ErrorRate:         s.ErrorRate(),
+			P50Millis:         toMillis(s.p50),
+			P90Millis:         toMillis(s.p90),
+			P99Millis:         toMillis(s.p99),
+			InFlight:          s.inFlight,
+			Server:            s.server,
+		})
+	}
+	return report
+}
+
+// redactHeader leaves out the value of a sensitive header line.
+func redactHeader(header string) string {
+	name, _, found := strings.Cut(header, ":")
+	if !found {
+		return header
+	}
+	for _, sensitive := range sensitiveHeaders {
+		if http.CanonicalHeaderKey(strings.TrimSpace(name)) == sensitive {
+			return name + ": [redacted]"
+		}
+	}
+	return header
+}
+
+func (r *JSONReport) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteJSONReport writes the JSON report to the file of -json, or to stdout
+// if it is '-'.
+func WriteJSONReport(context *Context, stats *Stats) error {
+	report := NewJSONReport(context, stats)
+	if context.config.jsonReport == "-" {
+		return report.Write(os.Stdout)
+	}
+
+	file, err := os.Create(context.config.jsonReport)
+	if err != nil {
+		return err
+	}
+	if err = report.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// toMillis converts d to milliseconds.
+func toMillis(d time.Duration) float64 {
+	return MillisecondTimeUnit.Value(d)
+}
@@ -6,6 +6,8 @@ import (
 	"os/signal"
 	_ "sync/atomic"
 	"time"
+
+	"google.golang.org/grpc/codes"
 )
 
 type Monitor struct {
@@ -15,13 +17,20 @@ type Monitor struct {
 }
 
 type Stats struct {
-	responseTimeData []time.Duration
+	responseTimes *Histogram
 
+	start               time.Time
 	totalRequests       int
 	totalSuccess        int
 	totalExecutionTime  time.Duration
 	totalResponseTime   time.Duration
 	totalReceived       int64
+	totalSent           int64
+	totalWire           int64
+	totalEncodeTime     time.Duration
+	totalEncoded        int
+	totalDecodeTime     time.Duration
+	totalDecoded        int
 	totalFailedReqeusts int
 
 	errLength       int
@@ -34,6 +43,50 @@ type Stats struct {
 	errExceptionDur time.Duration
 	errResponse     int
 	errResponseDur  time.Duration
+	errTimeout      int
+	errTimeoutDur   time.Duration
+
+	errPortExhausted    int
+	errPortExhaustedDur time.Duration
+
+	grpcCodes    map[codes.Code]int
+	grpcCodesDur map[codes.Code]time.Duration
+
+	handshakeFull       int
+	handshakeFullDur    time.Duration
+	handshakeResumed    int
+	handshakeResumedDur time.Duration
+
+	remoteAddrs       map[string]int
+	remoteAddrsDur    map[string]time.Duration
+	remoteAddrsFailed map[string]int
+
+	proxyConnects   int
+	proxyConnectDur time.Duration
+	proxyOriginDur  time.Duration
+
+	connNew           int
+	connNewSuccess    int
+	connNewDur        time.Duration
+	connReused        int
+	connReusedSuccess int
+	connReusedDur     time.Duration
+
+	statusCodes    map[int]int
+	statusCodesDur map[int]time.Duration
+
+	redirected   int
+	redirectHops int
+	redirectDur  time.Duration
+
+	intervals []*IntervalStats
+	scrapes   []*ScrapeSample
+
+	errKinds    map[string]int
+	errMessages map[string]map[string]int
+
+	client      *ClientStats
+	queueDelays *Histogram
 }
 
 func NewMonitor(context *Context, collector chan *Record) *Monitor {
@@ -47,7 +100,7 @@ func (m *Monitor) Run() {
 	signal.Notify(userInterrupt, os.Interrupt)
 
 	stats := &Stats{totalResponseTime: time.Duration(0)}
-	stats.responseTimeData = make([]time.Duration, 0, m.c.config.requests)
+	stats.responseTimes = newResponseTimeHistogram()
 
 	var timelimiter <-chan time.Time
 	if m.c.config.timelimit > 0 {
@@ -59,10 +112,43 @@ func (m *Monitor) Run() {
 	// waiting for all of http workers to start
 	m.c.start.Wait()
 
-	fmt.Printf("Benchmarking %s (be patient)\n", m.c.config.host)
+	out := m.c.config.progressOutput()
+	if m.c.config.unixSocket != "" {
+		fmt.Fprintf(out, "Benchmarking %s (be patient)\n", m.c.config.unixSocket)
+	} else {
+		fmt.Fprintf(out, "Benchmarking %s (be patient)\n", m.c.config.host)
+	}
 	m.c.startRun.Done()
 	sw := &StopWatch{}
 	sw.Start()
+	stats.start = sw.start
+
+	var intervals *intervalRecorder
+	var ticker <-chan time.Time
+	if m.c.config.interval > 0 {
+		intervals = newIntervalRecorder(sw.start)
+		t := time.NewTicker(m.c.config.interval)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	scraper := m.c.config.scraper
+	if scraper != nil {
+		scraper.Start(sw.start, m.c.config.scrapeInterval)
+	}
+
+	stats.client = newClientStats(sw.start, m.c.config.concurrency)
+	sampler := time.NewTicker(ClientSampleInterval)
+	defer sampler.Stop()
+
+	var dashboard *Dashboard
+	var refresh <-chan time.Time
+	if m.c.config.dashboard {
+		dashboard = NewDashboard(m.c, out, sw.start)
+		t := time.NewTicker(DashboardRefresh)
+		defer t.Stop()
+		refresh = t.C
+	}
 
 loop:
 	for {
@@ -70,20 +156,73 @@ loop:
 		case record := <-m.collector:
 
 			updateStats(stats, record)
+			if intervals != nil {
+				intervals.record(record)
+			}
+			if dashboard != nil {
+				dashboard.record(record)
+			}
+			if m.c.config.IsGRPC() {
+				updateGRPCStats(stats, record)
+			}
+			if m.c.config.tlsHandshake {
+				updateHandshakeStats(stats, record)
+			}
+			if m.c.config.resolver != nil {
+				updateRemoteAddrStats(stats, record)
+			}
+
+			if m.c.config.proxy != nil {
+				updateProxyStats(stats, record)
+			}
+
+			if record.conn != connUnknown {
+				updateConnStats(stats, record)
+			}
+
+			if record.statusCode != 0 {
+				updateStatusStats(stats, record)
+			}
+
+			if record.redirects > 0 {
+				updateRedirectStats(stats, record)
+			}
+
+			// only the HTTP workers queue jobs with their time, the queueing
+			// delay is not shown for the other ones
+			if record.queueDelay > 0 {
+				updateQueueStats(stats, record)
+			}
 
 			if record.Error != nil && !ContinueOnError {
 				break loop
 			}
 
-			if stats.totalRequests >= 10 && stats.totalRequests%(m.c.config.requests/10) == 0 {
-				fmt.Printf("Completed %d requests\n", stats.totalRequests)
+			if dashboard == nil && stats.totalRequests >= 10 && stats.totalRequests%(m.c.config.requests/10) == 0 {
+				fmt.Fprintf(out, "Completed %d requests\n", stats.totalRequests)
 			}
 
 			if stats.totalRequests == m.c.config.requests {
-				fmt.Printf("Finished %d requests\n", stats.totalRequests)
+				fmt.Fprintf(out, "Finished %d requests\n", stats.totalRequests)
 				break loop
 			}
 
+		case now := <-ticker:
+			s := intervals.flush(now, m.c.InFlight())
+			if scraper != nil {
+				s.server = scraper.Latest()
+			}
+			stats.intervals = append(stats.intervals, s)
+			if dashboard == nil {
+				fmt.Fprintln(out, s.Format(m.c.config.timeUnit))
+			}
+
+		case now := <-sampler.C:
+			stats.client.sample(now)
+
+		case now := <-refresh:
+			dashboard.Refresh(now, stats)
+
 		case <-timelimiter:
 			break loop
 		case <-userInterrupt:
@@ -93,6 +232,20 @@ loop:
 
 	sw.Stop()
 	stats.totalExecutionTime = sw.Elapsed
+	stats.client.sample(time.Now())
+	if dashboard != nil {
+		dashboard.Refresh(time.Now(), stats)
+	}
+	if intervals != nil && intervals.requests > 0 {
+		s := intervals.flush(time.Now(), m.c.InFlight())
+		if scraper != nil {
+			s.server = scraper.Latest()
+		}
+		stats.intervals = append(stats.intervals, s)
+	}
+	if scraper != nil {
+		stats.scrapes = scraper.Stop()
+	}
 
 	// shutdown benchmark and all of httpworkers to stop
 	close(m.c.stop)
@@ -105,11 +258,15 @@ func updateStats(stats *Stats, record *Record) {
 
 	if record.Error != nil {
 		stats.totalFailedReqeusts++
+		updateErrorKinds(stats, record.Error)
 
 		switch record.Error.(type) {
 		case *ConnectError:
 			stats.errConnect++
 			stats.errConnectDur += record.responseTime
+		case *PortExhaustedError:
+			stats.errPortExhausted++
+			stats.errPortExhaustedDur += record.responseTime
 		case *ExceptionError:
 			stats.errException++
 			stats.errExceptionDur += record.responseTime
@@ -119,9 +276,12 @@ func updateStats(stats *Stats, record *Record) {
 		case *ReceiveError:
 			stats.errReceive++
 			stats.errReceiveDur += record.responseTime
-		case *ResponseError:
+		case *ResponseError, *RedirectError:
 			stats.errResponse++
 			stats.errResponseDur += record.responseTime
+		case *ResponseTimeoutError:
+			stats.errTimeout++
+			stats.errTimeoutDur += record.responseTime
 		default:
 			stats.errException++
 			stats.errExceptionDur += record.responseTime
@@ -131,8 +291,32 @@ func updateStats(stats *Stats, record *Record) {
 		//		stats.totalResponseTime = time.Duration(int64(stats.totalResponseTime) + int64(record.responseTime))
 		stats.totalResponseTime += record.responseTime
 		stats.totalReceived += record.contentSize
-		stats.responseTimeData = append(stats.responseTimeData, record.responseTime)
+		stats.totalSent += record.uploadSize
+		stats.totalWire += record.wireSize
+		if record.encodeTime > 0 {
+			stats.totalEncodeTime += record.encodeTime
+			stats.totalEncoded++
+		}
+		if record.decodeTime > 0 {
+			stats.totalDecodeTime += record.decodeTime
+			stats.totalDecoded++
+		}
+		if stats.responseTimes == nil {
+			stats.responseTimes = newResponseTimeHistogram()
+		}
+		stats.responseTimes.Record(record.responseTime)
 		stats.totalSuccess++
 	}
 
 }
+
+func updateGRPCStats(stats *Stats, record *Record) {
+	if stats.grpcCodes == nil {
+		stats.grpcCodes = make(map[codes.Code]int)
+		stats.grpcCodesDur = make(map[codes.Code]time.Duration)
+	}
+
+	code := grpcCode(record.Error)
+	stats.grpcCodes[code]++
+	stats.grpcCodesDur[code] += record.responseTime
+}
@@ -18,8 +18,8 @@ func TestMonitorWithSuccessedResponse(t *testing.T) {
 	context := NewContext(config)
 	monitor := NewMonitor(context, collector)
 
-	request1 := &Record{10, 10, nil}
-	request2 := &Record{20, 20, nil}
+	request1 := &Record{responseTime: 10 * time.Millisecond, contentSize: 10}
+	request2 := &Record{responseTime: 20 * time.Millisecond, contentSize: 20}
 
 	collector <- request1
 	collector <- request2
@@ -38,8 +38,9 @@ func TestMonitorWithSuccessedResponse(t *testing.T) {
 		t.Fatalf("expected %d requests, actual %d requests", config.requests, stats.totalRequests)
 	}
 
-	if stats.responseTimeData[0] != request1.responseTime || stats.responseTimeData[1] != request2.responseTime {
-		t.Fatalf("expected %s responseTimeData, actual %s responseTimeData", []time.Duration{request1.responseTime, request2.responseTime}, stats.responseTimeData)
+	if stats.responseTimes.TotalCount() != 2 || stats.responseTimes.Min() != request1.responseTime || stats.responseTimes.Max() != request2.responseTime {
+		t.Fatalf("expected %s response times, actual %d between %s and %s", []time.Duration{request1.responseTime, request2.responseTime},
+			stats.responseTimes.TotalCount(), stats.responseTimes.Min(), stats.responseTimes.Max())
 	}
 
 	if stats.totalReceived != request1.contentSize+request2.contentSize {
@@ -0,0 +1,159 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-errors/errors"
+)
+
+// FormPart is a field or a file of a multipart form.
+type FormPart struct {
+	Name        string
+	Value       []byte
+	FileName    string // empty for fields
+	ContentType string
+}
+
+// Form builds multipart/form-data bodies. When Vary is set, the request index
+// is added to file names and appended to file contents, so every request
+// uploads a different file.
+type Form struct {
+	Parts []*FormPart
+	Vary  bool
+
+	boundary string
+	next     int64
+}
+
+// NewForm parses curl-style part specs, 'name=value' for a field and
+// 'name=@path' for a file, each optionally followed by ';type=content/type'
+// and ';filename=name'.
+func NewForm(specs []string, vary bool) (*Form, error) {
+	form := &Form{Vary: vary, boundary: multipart.NewWriter(nil).Boundary()}
+
+	for _, spec := range specs {
+		part, err := parseFormPart(spec)
+		if err != nil {
+			return nil, err
+		}
+		form.Parts = append(form.Parts, part)
+	}
+
+	if len(form.Parts) == 0 {
+		return nil, errors.New("no form part given")
+	}
+	return form, nil
+}
+
+func parseFormPart(spec string) (*FormPart, error) {
+	i := strings.Index(spec, "=")
+	if i <= 0 {
+		return nil, errors.New("invalid form part, expected name=value or name=@file - " + spec)
+	}
+	part := &FormPart{Name: spec[:i]}
+
+	options := strings.Split(spec[i+1:], ";")
+	value := options[0]
+	for _, option := range options[1:] {
+		kv := strings.SplitN(strings.TrimSpace(option), "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("invalid form part option: " + option)
+		}
+		switch kv[0] {
+		case "type":
+			part.ContentType = kv[1]
+		case "filename":
+			part.FileName = kv[1]
+		default:
+			return nil, errors.New("unknown form part option: " + kv[0])
+		}
+	}
+
+	if !strings.HasPrefix(value, "@") {
+		part.Value = []byte(value)
+		return part, nil
+	}
+
+	path := value[1:]
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	part.Value = content
+	if part.FileName == "" {
+		part.FileName = filepath.Base(path)
+	}
+	if part.ContentType == "" {
+		if part.ContentType = mime.TypeByExtension(filepath.Ext(path)); part.ContentType == "" {
+			part.ContentType = "application/octet-stream"
+		}
+	}
+	return part, nil
+}
+
+func (f *Form) ContentType() string {
+	return "multipart/form-data; boundary=" + f.boundary
+}
+
+// Build returns the body of the next request.
+func (f *Form) Build() []byte {
+	index := int(atomic.AddInt64(&f.next, 1) - 1)
+
+	var buffer bytes.Buffer
+	w := multipart.NewWriter(&buffer)
+	w.SetBoundary(f.boundary)
+
+	for _, part := range f.Parts {
+		header := make(textproto.MIMEHeader)
+		disposition := map[string]string{"name": part.Name}
+		value := part.Value
+
+		if part.FileName != "" {
+			disposition["filename"] = part.FileName
+			if f.Vary {
+				disposition["filename"] = varyFileName(part.FileName, index)
+				value = append(value[:len(value):len(value)], strconv.Itoa(index)...)
+			}
+		}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", disposition))
+		if part.ContentType != "" {
+			header.Set("Content-Type", part.ContentType)
+		}
+
+		// writes to a bytes.Buffer never fail
+		pw, _ := w.CreatePart(header)
+		pw.Write(value)
+	}
+	w.Close()
+	return buffer.Bytes()
+}
+
+// varyFileName inserts index before the extension, eg. 'photo-3.png'.
+func varyFileName(name string, index int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), index, ext)
+}
+
+func (f *Form) String() string {
+	var files int
+	for _, part := range f.Parts {
+		if part.FileName != "" {
+			files++
+		}
+	}
+
+	s := fmt.Sprintf("multipart/form-data (%d fields, %d files)", len(f.Parts)-files, files)
+	if f.Vary {
+		s += ", varied per request"
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package gb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseFormPart(t *testing.T) {
+	part, err := parseFormPart("meta={\"a\":1};type=application/json")
+	if err != nil {
+		t.Fatalf("parse form part failed: %s", err)
+	}
+	if part.Name != "meta" || string(part.Value) != "{\"a\":1}" || part.ContentType != "application/json" || part.FileName != "" {
+		t.Fatalf("unexpected form part %#+v", part)
+	}
+
+	for _, spec := range []string{"novalue", "=value", "a=b;size=1", "a=@/not/exist"} {
+		if _, err := parseFormPart(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+type readPart struct {
+	*multipart.Part
+	content string
+}
+
+func readForm(t *testing.T, contentType string, body []byte) map[string]*readPart {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+
+	parts := make(map[string]*readPart)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(part)
+		parts[part.FormName()] = &readPart{part, string(content)}
+	}
+	return parts
+}
+
+func TestFormBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gbtest")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "photo.png")
+	ioutil.WriteFile(file, []byte("png"), 0600)
+
+	form, err := NewForm([]string{"title=hello", "image=@" + file, "doc=@" + file + ";type=text/plain;filename=a.txt"}, true)
+	if err != nil {
+		t.Fatalf("new form failed: %s", err)
+	}
+
+	for index, expected := range []string{"photo-0.png", "photo-1.png"} {
+		parts := readForm(t, form.ContentType(), form.Build())
+		if len(parts) != 3 {
+			t.Fatalf("expected 3 parts, got %d", len(parts))
+		}
+
+		if parts["title"].content != "hello" {
+			t.Errorf("expected title hello, got %q", parts["title"].content)
+		}
+
+		image := parts["image"]
+		if image.FileName() != expected || image.Header.Get("Content-Type") != "image/png" || image.content != "png"+strconv.Itoa(index) {
+			t.Errorf("unexpected image part %s %s %q", image.FileName(), image.Header.Get("Content-Type"), image.content)
+		}
+
+		doc := parts["doc"]
+		if doc.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("expected text/plain, got %s", doc.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestHTTPWorkerWithForm(t *testing.T) {
+	form, _ := NewForm([]string{"name=gb", "data=payload;type=application/octet-stream;filename=data.bin"}, false)
+	config := &Config{form: form, contentType: form.ContentType(), bodyContent: form.Build()}
+
+	request, content, record := sendBody(t, config)
+
+	parts := readForm(t, request.Header.Get("Content-Type"), content)
+	if parts["data"].FileName() != "data.bin" || parts["data"].content != "payload" {
+		t.Fatalf("unexpected file part %s %q", parts["data"].FileName(), parts["data"].content)
+	}
+	if record.uploadSize != int64(len(config.bodyContent)) {
+		t.Fatalf("expected %d bytes sent, got %d", len(config.bodyContent), record.uploadSize)
+	}
+}
@@ -0,0 +1,111 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+const (
+	FieldHTTPClient = "HTTPClient"
+
+	PoolWorker = "worker"
+	PoolShared = "shared"
+)
+
+// PoolOptions control the connection pool of http clients.
+type PoolOptions struct {
+	Shared          bool          // one pool for all of workers instead of one per worker
+	MaxConnsPerHost int           // zero for no limit
+	IdleTimeout     time.Duration // zero for no timeout
+	RequestsPerConn int           // close connections after the number of requests, zero for no limit; not with Shared
+}
+
+func (o *PoolOptions) String() string {
+	options := []string{PoolWorker}
+	if o.Shared {
+		options[0] = PoolShared
+	}
+
+	if o.MaxConnsPerHost > 0 {
+		options = append(options, fmt.Sprintf("max-conns=%d", o.MaxConnsPerHost))
+	}
+	if o.IdleTimeout > 0 {
+		options = append(options, "idle-timeout="+o.IdleTimeout.String())
+	}
+	if o.RequestsPerConn > 0 {
+		options = append(options, fmt.Sprintf("requests-per-conn=%d", o.RequestsPerConn))
+	}
+	return strings.Join(options, " ")
+}
+
+// newPooledClient returns the http client of a worker, which is the shared
+// client when the pool is shared among workers.
+func newPooledClient(context *Context) *http.Client {
+	config := context.config
+	if config.pool == nil || !config.pool.Shared {
+		return NewClient(config)
+	}
+
+	if client, ok := context.GetValue(FieldHTTPClient).(*http.Client); ok {
+		return client
+	}
+	client := NewClient(config)
+	context.SetValue(FieldHTTPClient, client)
+	return client
+}
+
+type connUse int8
+
+const (
+	connUnknown connUse = iota
+	connNew
+	connReused
+)
+
+// traceConnUse stores whether request got a new or a reused connection into
+// use.
+func traceConnUse(request *http.Request, use *connUse) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				*use = connReused
+			} else {
+				*use = connNew
+			}
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
+func updateConnStats(stats *Stats, record *Record) {
+	switch record.conn {
+	case connNew:
+		stats.connNew++
+		if record.Error == nil {
+			stats.connNewSuccess++
+			stats.connNewDur += record.responseTime
+		}
+	case connReused:
+		stats.connReused++
+		if record.Error == nil {
+			stats.connReusedSuccess++
+			stats.connReusedDur += record.responseTime
+		}
+	}
+}
+
+func printConnStats(buffer *bytes.Buffer, stats *Stats, unit TimeUnit) {
+	total := stats.connNew + stats.connReused
+	if total == 0 {
+		return
+	}
+
+	fmt.Fprintf(buffer, "Connections opened:     %d\n", stats.connNew)
+	fmt.Fprintf(buffer, "Connection reuse:       %.2f%% (%d of %d requests)\n", float64(stats.connReused)*100/float64(total), stats.connReused, total)
+	fmt.Fprintf(buffer, "Request time (new):     %s [%s] (mean, new connection)\n", unit.Format(avg(stats.connNewDur, stats.connNewSuccess)), unit)
+	fmt.Fprintf(buffer, "Request time (reused):  %s [%s] (mean, reused connection)\n", unit.Format(avg(stats.connReusedDur, stats.connReusedSuccess)), unit)
+}
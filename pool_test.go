@@ -0,0 +1,141 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolOptionsString(t *testing.T) {
+	if actual := (&PoolOptions{}).String(); actual != "worker" {
+		t.Errorf("expected worker, got %q", actual)
+	}
+
+	options := &PoolOptions{Shared: true, MaxConnsPerHost: 8, IdleTimeout: 30 * time.Second, RequestsPerConn: 100}
+	expected := "shared max-conns=8 idle-timeout=30s requests-per-conn=100"
+	if actual := options.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestSharedPool(t *testing.T) {
+	config := &Config{concurrency: 2, requests: 2, pool: &PoolOptions{Shared: true}}
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 0)
+
+	first := NewHTTPWorker(context, nil, nil)
+	second := NewHTTPWorker(context, nil, nil)
+	if first.client != second.client {
+		t.Fatal("expected workers to share the http client")
+	}
+
+	config.pool.Shared = false
+	if NewHTTPWorker(context, nil, nil).client == first.client {
+		t.Fatal("expected a http client per worker")
+	}
+}
+
+func TestHTTPWorkerWithRequestsPerConn(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         5,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		keepAlive:        true,
+		url:              ts.URL,
+		pool:             &PoolOptions{RequestsPerConn: 2},
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	stats := &Stats{}
+	for i := 0; i < config.requests; i++ {
+		request, _ := NewHTTPRequest(config)
+		jobs <- NewHTTPJob(request)
+		record := <-collector
+		if record.Error != nil {
+			t.Fatalf("send http request failed: %s", record.Error)
+		}
+		updateConnStats(stats, record)
+	}
+	close(jobs)
+	close(context.stop)
+
+	// requests 1, 3 and 5 open a connection
+	if stats.connNew != 3 || stats.connReused != 2 {
+		t.Fatalf("expected 3 new and 2 reused connections, got %d and %d", stats.connNew, stats.connReused)
+	}
+
+	var buffer bytes.Buffer
+	printConnStats(&buffer, stats, MillisecondTimeUnit)
+	if !strings.Contains(buffer.String(), "Connection reuse:       40.00% (2 of 5 requests)") {
+		t.Fatalf("unexpected connection report:\n%s", buffer.String())
+	}
+}
+
+func TestHTTPWorkerWithRequestsPerConnClosedByServer(t *testing.T) {
+	var served int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&served, 1) == 1 {
+			w.Header().Set("Connection", "close")
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         5,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		keepAlive:        true,
+		url:              ts.URL,
+		pool:             &PoolOptions{RequestsPerConn: 3},
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	var uses []connUse
+	for i := 0; i < config.requests; i++ {
+		request, _ := NewHTTPRequest(config)
+		jobs <- NewHTTPJob(request)
+		record := <-collector
+		if record.Error != nil {
+			t.Fatalf("send http request failed: %s", record.Error)
+		}
+		uses = append(uses, record.conn)
+	}
+	close(jobs)
+	close(context.stop)
+
+	// the server closes the first connection, the count starts again on the
+	// second one
+	expected := []connUse{connNew, connNew, connReused, connReused, connNew}
+	if fmt.Sprint(uses) != fmt.Sprint(expected) {
+		t.Fatalf("expected connections %v, got %v", expected, uses)
+	}
+}
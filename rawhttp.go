@@ -0,0 +1,465 @@
+package gb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+var (
+	ErrMalformedResponse = errors.New("malformed http response")
+
+	rawHTTPVersion      = []byte("HTTP/1.")
+	rawContentLength    = []byte("Content-Length")
+	rawTransferEncoding = []byte("Transfer-Encoding")
+	rawConnection       = []byte("Connection")
+	rawChunked          = []byte("chunked")
+	rawClose            = []byte("close")
+	rawKeepAlive        = []byte("keep-alive")
+)
+
+// RawHTTPWorker writes a pre-serialised request straight to a TCP connection
+// and parses the responses without net/http. Up to depth requests are
+// pipelined on the connection.
+type RawHTTPWorker struct {
+	c         *Context
+	jobs      chan struct{}
+	collector chan *Record
+	request   []byte
+	head      bool
+	depth     int
+	addr      string
+	tlsConfig *tls.Config
+	dial      DialFunc
+
+	mu      sync.Mutex
+	stopped bool
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+
+	// send times of in-flight requests, a ring buffer starting at first
+	sent     []time.Time
+	first    int
+	inflight int
+	written  int
+
+	// the oldest in-flight requests lost with a dropped connection
+	lost    int
+	lostErr error
+}
+
+func NewRawHTTPWorker(context *Context, request []byte, jobs chan struct{}, collector chan *Record) *RawHTTPWorker {
+	config := context.config
+
+	depth := config.pipeline
+	if depth < 1 || !config.keepAlive {
+		depth = 1
+	}
+
+	worker := &RawHTTPWorker{
+		c:         context,
+		jobs:      jobs,
+		collector: collector,
+		request:   request,
+		head:      config.method == "HEAD",
+		depth:     depth,
+		addr:      net.JoinHostPort(config.host, strconv.Itoa(config.port)),
+		sent:      make([]time.Time, depth),
+		dial:      NewDialer(config),
+	}
+
+	if URL, err := url.Parse(config.url); err == nil && URL.Scheme == "https" {
+		worker.tlsConfig = newClientTLSConfig(config)
+		worker.tlsConfig.NextProtos = []string{"http/1.1"}
+		if worker.tlsConfig.ServerName == "" {
+			worker.tlsConfig.ServerName = config.host
+		}
+	}
+	return worker
+}
+
+// NewRawHTTPRequest serialises the configured request into the bytes written
+// by RawHTTPWorker.
+func NewRawHTTPRequest(config *Config) ([]byte, error) {
+	request, err := NewHTTPRequest(config)
+	if err != nil {
+		return nil, err
+	}
+	request.Close = !config.keepAlive
+
+	var buffer bytes.Buffer
+	if err := request.Write(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (h *RawHTTPWorker) Run(i int) {
+	h.c.start.Done()
+	h.c.startRun.Wait()
+
+	go func() {
+		<-h.c.stop
+		h.mu.Lock()
+		h.stopped = true
+		if h.conn != nil {
+			h.conn.Close()
+		}
+		h.mu.Unlock()
+	}()
+	defer h.close()
+
+	var count int = 0
+	closed := false
+	for {
+
+		// take jobs until the pipeline is full, but only wait for one
+		// when there is nothing in flight
+	fill:
+		for !closed && h.inflight < h.depth {
+			var ok bool
+			if h.inflight == 0 {
+				_, ok = <-h.jobs
+			} else {
+				select {
+				case _, ok = <-h.jobs:
+				default:
+					break fill
+				}
+			}
+			if !ok {
+				closed = true
+				break
+			}
+			TakeRatelimitToken(i)
+			h.inflight++
+			h.c.BeginRequest()
+		}
+
+		if h.inflight == 0 || h.isStopped() {
+			return
+		}
+
+		record := h.roundTrip()
+		if h.isStopped() {
+			return
+		}
+
+		count++
+		if h.c.config.skipFirst && count == 1 {
+			continue
+		}
+
+		select {
+		case h.collector <- record:
+		case <-h.c.stop:
+			return
+		}
+	}
+}
+
+// roundTrip writes every in-flight request which is not on the wire yet and
+// reads the response of the oldest one.
+func (h *RawHTTPWorker) roundTrip() (record *Record) {
+	record = &Record{}
+
+	if h.lost > 0 {
+		record.Error = h.lostErr
+		record.responseTime = time.Now().Sub(h.sent[h.first])
+		h.lost--
+		h.done(record)
+		return
+	}
+
+	if h.conn == nil {
+		if err := h.connect(); err != nil {
+			if isPortExhausted(err) {
+				record.Error = &PortExhaustedError{err}
+			} else {
+				record.Error = &ConnectError{err}
+			}
+			h.done(record)
+			return
+		}
+	}
+
+	if h.written < h.inflight {
+		now := time.Now()
+		for ; h.written < h.inflight; h.written++ {
+			h.sent[(h.first+h.written)%h.depth] = now
+			h.writer.Write(h.request)
+		}
+		if err := h.writer.Flush(); err != nil {
+			record.Error = &ConnectError{err}
+			h.drop(record.Error)
+			h.done(record)
+			return
+		}
+	}
+
+	if h.c.config.resolver != nil {
+		record.remoteAddr = h.conn.RemoteAddr().String()
+	}
+
+	h.conn.SetReadDeadline(time.Now().Add(h.c.config.executionTimeout))
+	status, n, closing, err := readRawResponse(h.reader, h.head)
+	record.responseTime = time.Now().Sub(h.sent[h.first])
+	if err == nil {
+		record.statusCode = status
+	}
+
+	switch {
+	case err != nil:
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			record.Error = &ResponseTimeoutError{err}
+		} else if err == io.ErrUnexpectedEOF {
+			record.Error = &LengthError{ErrInvalidContnetSize}
+		} else {
+			record.Error = &ReceiveError{err}
+		}
+		h.drop(record.Error)
+	case !h.c.config.successCodes.Match(status):
+		record.contentSize = n
+		record.Error = &ResponseError{errors.Errorf("Response is %d", status)}
+	default:
+		record.contentSize = n
+	}
+
+	if err == nil && (closing || !h.c.config.keepAlive) {
+		h.close()
+	}
+
+	h.done(record)
+	return
+}
+
+// done completes the oldest in-flight request.
+func (h *RawHTTPWorker) done(record *Record) {
+	if h.written > 0 {
+		h.written--
+	}
+	h.first = (h.first + 1) % h.depth
+	h.inflight--
+	h.c.EndRequest()
+
+	if record.Error != nil {
+		TraceException(record.Error.Error())
+	}
+}
+
+func (h *RawHTTPWorker) connect() (err error) {
+	conn, err := h.dial(context.Background(), "tcp", h.addr)
+	if err != nil {
+		return
+	}
+	if h.tlsConfig != nil {
+		tlsConn := tls.Client(conn, h.tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return
+		}
+		conn = tlsConn
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		conn.Close()
+		return errors.New("benchmark stopped")
+	}
+
+	h.conn = conn
+	h.reader = bufio.NewReaderSize(conn, MaxBufferSize)
+	h.writer = bufio.NewWriterSize(conn, MaxBufferSize)
+	return
+}
+
+// drop closes the connection after err. The requests on the wire may have
+// been handled by the server, they fail with err instead of being written
+// again on the next connection.
+func (h *RawHTTPWorker) drop(err error) {
+	h.lost = h.written - 1
+	h.lostErr = err
+	h.close()
+}
+
+// close closes the connection; requests already on the wire are written
+// again on the next connection, the server handles no more requests after
+// it closes the connection as announced.
+func (h *RawHTTPWorker) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+	h.written = 0
+}
+
+func (h *RawHTTPWorker) isStopped() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stopped
+}
+
+// readRawResponse parses a response and discards its body. It returns the
+// status code, the body size and whether the server closes the connection.
+func readRawResponse(r *bufio.Reader, head bool) (status int, n int64, closing bool, err error) {
+	contentLength := int64(-1)
+	chunked := false
+
+	for {
+		var line []byte
+		if line, err = r.ReadSlice('\n'); err != nil {
+			return
+		}
+
+		// status line, eg. HTTP/1.1 200 OK
+		if len(line) < 12 || !bytes.HasPrefix(line, rawHTTPVersion) || line[8] != ' ' {
+			err = ErrMalformedResponse
+			return
+		}
+		closing = line[7] == '0'
+		if status, err = parseRawInt(line[9:12], 10); err != nil {
+			return
+		}
+
+		for {
+			if line, err = r.ReadSlice('\n'); err != nil {
+				return
+			}
+			line = bytes.TrimRight(line, "\r\n")
+			if len(line) == 0 {
+				break
+			}
+
+			colon := bytes.IndexByte(line, ':')
+			if colon <= 0 {
+				continue
+			}
+			name, value := line[:colon], bytes.TrimSpace(line[colon+1:])
+
+			switch {
+			case bytes.EqualFold(name, rawContentLength):
+				var length int
+				if length, err = parseRawInt(value, 10); err != nil {
+					return
+				}
+				contentLength = int64(length)
+			case bytes.EqualFold(name, rawTransferEncoding):
+				chunked = bytes.EqualFold(value, rawChunked)
+			case bytes.EqualFold(name, rawConnection):
+				if bytes.EqualFold(value, rawClose) {
+					closing = true
+				} else if bytes.EqualFold(value, rawKeepAlive) {
+					closing = false
+				}
+			}
+		}
+
+		// skip interim responses, eg. 100 Continue
+		if status/100 != 1 || status == 101 {
+			break
+		}
+	}
+
+	if head || status/100 == 1 || status == 204 || status == 304 {
+		return
+	}
+
+	switch {
+	case chunked:
+		n, err = discardChunked(r)
+	case contentLength >= 0:
+		var discarded int
+		discarded, err = r.Discard(int(contentLength))
+		n = int64(discarded)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	default:
+		// body is delimited by the end of connection
+		n, err = io.Copy(ioutil.Discard, r)
+		closing = true
+	}
+	return
+}
+
+func discardChunked(r *bufio.Reader) (n int64, err error) {
+	for {
+		var line []byte
+		if line, err = r.ReadSlice('\n'); err != nil {
+			return
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if ext := bytes.IndexByte(line, ';'); ext >= 0 {
+			line = line[:ext]
+		}
+
+		var size int
+		if size, err = parseRawInt(bytes.TrimSpace(line), 16); err != nil {
+			return
+		}
+
+		if size == 0 {
+			// skip trailers
+			for {
+				if line, err = r.ReadSlice('\n'); err != nil {
+					return
+				}
+				if len(bytes.TrimRight(line, "\r\n")) == 0 {
+					return
+				}
+			}
+		}
+
+		var discarded int
+		discarded, err = r.Discard(size)
+		n += int64(discarded)
+		if err == nil {
+			_, err = r.ReadSlice('\n')
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+	}
+}
+
+// parseRawInt parses a non-negative integer without allocation.
+func parseRawInt(b []byte, base int) (n int, err error) {
+	if len(b) == 0 {
+		return 0, ErrMalformedResponse
+	}
+	for _, c := range b {
+		var digit int
+		switch {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case base == 16 && c >= 'a' && c <= 'f':
+			digit = int(c-'a') + 10
+		case base == 16 && c >= 'A' && c <= 'F':
+			digit = int(c-'A') + 10
+		default:
+			return 0, ErrMalformedResponse
+		}
+		n = n*base + digit
+		if n < 0 {
+			return 0, ErrMalformedResponse
+		}
+	}
+	return
+}
@@ -0,0 +1,269 @@
+package gb
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadRawResponse(t *testing.T) {
+
+	type Expected struct {
+		status  int
+		n       int64
+		closing bool
+	}
+
+	testData := []struct {
+		response string
+		head     bool
+		expected Expected
+	}{
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", false, Expected{200, 5, false}},
+		{"HTTP/1.1 200 OK\r\ncontent-length: 5\r\nConnection: close\r\n\r\nhello", false, Expected{200, 5, true}},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\nA\r\n0123456789\r\n0\r\nX-Trailer: 1\r\n\r\n", false, Expected{200, 15, false}},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", true, Expected{200, 0, false}},
+		{"HTTP/1.1 204 No Content\r\n\r\n", false, Expected{204, 0, false}},
+		{"HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 404 Not Found\r\nContent-Length: 3\r\n\r\nnot", false, Expected{404, 3, false}},
+		{"HTTP/1.0 200 OK\r\n\r\nuntil eof", false, Expected{200, 9, true}},
+		{"HTTP/1.0 200 OK\r\nConnection: keep-alive\r\nContent-Length: 0\r\n\r\n", false, Expected{200, 0, false}},
+	}
+
+	for _, data := range testData {
+		r := bufio.NewReader(strings.NewReader(data.response))
+		status, n, closing, err := readRawResponse(r, data.head)
+		if err != nil {
+			t.Errorf("parse %q failed: %s", data.response, err)
+			continue
+		}
+		if actual := (Expected{status, n, closing}); actual != data.expected {
+			t.Errorf("parse %q expected %+v, got %+v", data.response, data.expected, actual)
+		}
+	}
+}
+
+func TestRunRawWithInvalidRequest(t *testing.T) {
+	config := &Config{
+		concurrency:         2,
+		requests:            3,
+		method:              "GET",
+		executionTimeout:    MaxExecutionTimeout,
+		url:                 "http://localhost/",
+		host:                "localhost",
+		port:                80,
+		keepAlive:           true,
+		rawHTTP:             true,
+		basicAuthentication: "no-password",
+	}
+	context := NewContext(config)
+	benchmark := NewBenchmark(context)
+	go benchmark.RunRaw()
+	context.start.Wait()
+	context.startRun.Done()
+
+	for i := 0; i < config.requests; i++ {
+		record := <-benchmark.Collector
+		if _, ok := record.Error.(*ExceptionError); !ok {
+			t.Fatalf("expected the request to fail to be built, got %v", record.Error)
+		}
+	}
+	close(context.stop)
+}
+
+func TestReadRawResponseWithMalformedData(t *testing.T) {
+	testData := []string{
+		"SSH-2.0-OpenSSH\r\n",
+		"HTTP/1.1 2x0 OK\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nhello",
+	}
+
+	for _, response := range testData {
+		r := bufio.NewReader(strings.NewReader(response))
+		if _, _, _, err := readRawResponse(r, false); err == nil {
+			t.Errorf("expected error for %q", response)
+		}
+	}
+}
+
+func TestNewRawHTTPRequest(t *testing.T) {
+	request, err := NewRawHTTPRequest(postRequestConfig)
+	if err != nil {
+		t.Fatalf("new raw http request failed: %s", err)
+	}
+
+	if !bytes.HasPrefix(request, []byte("POST / HTTP/1.1\r\nHost: localhost\r\n")) {
+		t.Fatalf("unexpected request line: %q", request)
+	}
+	if !bytes.Contains(request, []byte("Connection: close\r\n")) {
+		t.Fatalf("expected connection close without keepalive: %q", request)
+	}
+	if !bytes.HasSuffix(request, postRequestConfig.bodyContent) {
+		t.Fatalf("expected body at the end of request: %q", request)
+	}
+}
+
+func testRawHTTPWorker(t *testing.T, keepAlive bool, pipeline int) {
+	requests := 20
+	responseStr := "hello"
+	var received int64
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&received, 1)
+		w.Write([]byte(responseStr))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         requests,
+		method:           "GET",
+		keepAlive:        keepAlive,
+		rawHTTP:          true,
+		pipeline:         pipeline,
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	URL, _ := url.Parse(ts.URL)
+	config.host, config.port, _ = extractHostAndPort(URL)
+
+	context := NewContext(config)
+	request, err := NewRawHTTPRequest(config)
+	if err != nil {
+		t.Fatalf("new raw http request failed: %s", err)
+	}
+
+	jobs := make(chan struct{}, requests)
+	collector := make(chan *Record, requests)
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	worker := NewRawHTTPWorker(context, request, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	for i := 0; i < requests; i++ {
+		record := <-collector
+		if record.Error != nil {
+			t.Fatalf("sent a raw http request but was error: %s", record.Error)
+		}
+		if record.contentSize != int64(len(responseStr)) {
+			t.Fatalf("sent a raw http request but content size dismatch")
+		}
+	}
+	close(context.stop)
+
+	if actualReceived := atomic.LoadInt64(&received); actualReceived != int64(requests) {
+		t.Fatalf("expected %d requests, server received %d", requests, actualReceived)
+	}
+}
+
+func TestRawHTTPWorker(t *testing.T) {
+	testRawHTTPWorker(t, false, 1)
+}
+
+func TestRawHTTPWorkerWithPipelining(t *testing.T) {
+	testRawHTTPWorker(t, true, 4)
+}
+
+func TestRawHTTPWorkerWithDroppedConnection(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the first connection answers the first of 3 pipelined requests and is
+	// dropped, the next ones answer every request
+	var received int64
+	go func() {
+		for first := true; ; first = false {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(first bool) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for n := 1; ; n++ {
+					if _, err := http.ReadRequest(r); err != nil {
+						return
+					}
+					atomic.AddInt64(&received, 1)
+					if first && n < 3 {
+						continue
+					}
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"))
+					if first {
+						return
+					}
+				}
+			}(first)
+		}
+	}()
+
+	requests := 3
+	config := &Config{
+		concurrency:      1,
+		requests:         requests,
+		method:           "GET",
+		keepAlive:        true,
+		rawHTTP:          true,
+		pipeline:         requests,
+		executionTimeout: MaxExecutionTimeout,
+		url:              "http://" + ln.Addr().String() + "/",
+	}
+	URL, _ := url.Parse(config.url)
+	config.host, config.port, _ = extractHostAndPort(URL)
+
+	context := NewContext(config)
+	request, err := NewRawHTTPRequest(config)
+	if err != nil {
+		t.Fatalf("new raw http request failed: %s", err)
+	}
+
+	jobs := make(chan struct{}, requests)
+	collector := make(chan *Record, requests)
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	worker := NewRawHTTPWorker(context, request, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	var failed int
+	for i := 0; i < requests; i++ {
+		if record := <-collector; record.Error != nil {
+			failed++
+		}
+	}
+	close(context.stop)
+
+	if failed != 2 {
+		t.Fatalf("expected the 2 requests on the dropped connection to fail, got %d failed", failed)
+	}
+	if actualReceived := atomic.LoadInt64(&received); actualReceived != int64(requests) {
+		t.Fatalf("expected %d requests, server received %d", requests, actualReceived)
+	}
+}
+
+func BenchmarkReadRawResponse(b *testing.B) {
+	b.ReportAllocs()
+	response := []byte("HTTP/1.1 200 OK\r\nServer: test\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello")
+	reader := bytes.NewReader(response)
+	r := bufio.NewReader(reader)
+	for i := 0; i < b.N; i++ {
+		reader.Reset(response)
+		r.Reset(reader)
+		readRawResponse(r, false)
+	}
+}
@@ -0,0 +1,99 @@
+package gb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// DefaultMaxRedirects is the number of redirects followed by net/http.
+const DefaultMaxRedirects = 10
+
+// RedirectOptions controls how redirect responses are followed.
+type RedirectOptions struct {
+	Max         int  // redirects followed, the redirect response is returned if 0
+	ExcludeTime bool // only the final hop counts toward the response time
+}
+
+func (r *RedirectOptions) max() int {
+	if r == nil {
+		return DefaultMaxRedirects
+	}
+	return r.Max
+}
+
+func (r *RedirectOptions) excludeTime() bool {
+	return r != nil && r.ExcludeTime
+}
+
+// checkRedirect is the CheckRedirect of http.Client, it stops after the
+// maximum of redirects and records the hops of traced requests.
+func (r *RedirectOptions) checkRedirect(request *http.Request, via []*http.Request) error {
+	if r.max() == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > r.max() {
+		return &RedirectError{errors.Errorf("stopped after %d redirects", r.max())}
+	}
+
+	if trace, ok := request.Context().Value(redirectTraceKey{}).(*redirectTrace); ok {
+		trace.hops = len(via)
+		trace.last = time.Now()
+	}
+	return nil
+}
+
+func (r *RedirectOptions) String() string {
+	if r.max() == 0 {
+		return "not followed"
+	}
+	s := fmt.Sprintf("follow up to %d", r.max())
+	if r.excludeTime() {
+		s += ", hops excluded from response time"
+	}
+	return s
+}
+
+type redirectTraceKey struct{}
+
+// redirectTrace is the number of redirects followed by a request and the
+// time the last one was.
+type redirectTrace struct {
+	hops int
+	last time.Time
+}
+
+func traceRedirect(request *http.Request, trace *redirectTrace) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), redirectTraceKey{}, trace))
+}
+
+// updateRedirect sets the redirect hops of request started at start into
+// record.
+func updateRedirect(record *Record, request *http.Request, start time.Time, excludeTime bool) {
+	trace, ok := request.Context().Value(redirectTraceKey{}).(*redirectTrace)
+	if !ok || trace.hops == 0 {
+		return
+	}
+
+	record.redirects = trace.hops
+	record.redirectTime = trace.last.Sub(start)
+	if excludeTime {
+		record.responseTime -= record.redirectTime
+	}
+}
+
+func updateRedirectStats(stats *Stats, record *Record) {
+	stats.redirected++
+	stats.redirectHops += record.redirects
+	stats.redirectDur += record.redirectTime
+}
+
+func printRedirectStats(buffer *bytes.Buffer, stats *Stats, unit TimeUnit) {
+	fmt.Fprintf(buffer, "Redirected requests:    %d (%d hops, %.2f per request)\n",
+		stats.redirected, stats.redirectHops, float64(stats.redirectHops)/float64(stats.redirected))
+	fmt.Fprintf(buffer, "Redirect Time:          %s [%s] (mean, per redirected request)\n", unit.Format(avg(stats.redirectDur, stats.redirected)), unit)
+}
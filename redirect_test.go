@@ -0,0 +1,98 @@
+package gb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRedirectServer redirects /r/N to /r/N-1 after delay, /r/0 responds.
+func newRedirectServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/r/"))
+		if n > 0 {
+			time.Sleep(delay)
+			http.Redirect(w, r, "/r/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+}
+
+// sendRedirect sends url through a worker of config and returns the record.
+func sendRedirect(t *testing.T, config *Config, url string) *Record {
+	config.concurrency = 1
+	config.requests = 1
+	config.method = "GET"
+	config.executionTimeout = MaxExecutionTimeout
+	config.url = url
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	request, _ := NewHTTPRequest(config)
+	jobs <- NewHTTPJob(request)
+	record := <-collector
+	close(jobs)
+	close(context.stop)
+	return record
+}
+
+func TestFollowRedirects(t *testing.T) {
+	ts := newRedirectServer(0)
+	defer ts.Close()
+
+	record := sendRedirect(t, &Config{}, ts.URL+"/r/3")
+	if record.Error != nil || record.statusCode != http.StatusOK {
+		t.Fatalf("expected the final response, got %d (%v)", record.statusCode, record.Error)
+	}
+	if record.redirects != 3 || record.redirectTime <= 0 {
+		t.Fatalf("expected 3 redirect hops, got %d in %s", record.redirects, record.redirectTime)
+	}
+
+	record = sendRedirect(t, &Config{redirect: &RedirectOptions{Max: 2}}, ts.URL+"/r/3")
+	if _, ok := record.Error.(*RedirectError); !ok {
+		t.Fatalf("expected redirect error, got %v", record.Error)
+	}
+}
+
+func TestNoRedirects(t *testing.T) {
+	ts := newRedirectServer(0)
+	defer ts.Close()
+
+	record := sendRedirect(t, &Config{redirect: &RedirectOptions{}}, ts.URL+"/r/1")
+	if _, ok := record.Error.(*ResponseError); !ok || record.statusCode != http.StatusFound || record.redirects != 0 {
+		t.Fatalf("expected failed redirect response, got %d with %d hops (%v)", record.statusCode, record.redirects, record.Error)
+	}
+
+	successCodes, _ := ParseStatusCodes("2xx,3xx")
+	record = sendRedirect(t, &Config{redirect: &RedirectOptions{}, successCodes: successCodes}, ts.URL+"/r/1")
+	if record.Error != nil || record.statusCode != http.StatusFound {
+		t.Fatalf("expected successful redirect response, got %d (%v)", record.statusCode, record.Error)
+	}
+}
+
+func TestExcludeRedirectTime(t *testing.T) {
+	delay := 50 * time.Millisecond
+	ts := newRedirectServer(delay)
+	defer ts.Close()
+
+	record := sendRedirect(t, &Config{}, ts.URL+"/r/2")
+	if record.responseTime < 2*delay {
+		t.Fatalf("expected redirect hops in response time, got %s", record.responseTime)
+	}
+
+	record = sendRedirect(t, &Config{redirect: &RedirectOptions{Max: DefaultMaxRedirects, ExcludeTime: true}}, ts.URL+"/r/2")
+	if record.redirectTime < 2*delay || record.responseTime >= delay {
+		t.Fatalf("expected only the final hop in response time, got %s after %s of redirects", record.responseTime, record.redirectTime)
+	}
+}
@@ -2,54 +2,120 @@ package gb
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
-	"math"
 	"net/url"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"google.golang.org/grpc/codes"
 )
 
-func PrintHeader() {
-	fmt.Println(`
-This is GoHttpBench, Version ` + GBVersion + `, https://github.com/parkghost/gohttpbench
+// PrintHeader prints the banner of gb to the progress output of config.
+func PrintHeader(config *Config) {
+	fmt.Fprintln(config.progressOutput(), `
+This is GoHttpBench, Version `+GBVersion+`, https://github.com/parkghost/gohttpbench
 Author: Brandon Chen, Email: parkghost@gmail.com
 Licensed under the MIT license
 `)
 }
 
-func div(dur time.Duration, count int) (rez float64) {
+// avg is the mean of count durations of total dur.
+func avg(dur time.Duration, count int) time.Duration {
 	if count == 0 {
 		return 0
-	} else {
-		return float64(dur.Nanoseconds()) / float64(time.Millisecond) / float64(count)
 	}
+	return dur / time.Duration(count)
 }
 
 func PrintReport(context *Context, stats *Stats) {
 
+	config := context.config
+	if config.jsonReport != "" {
+		if err := WriteJSONReport(context, stats); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write JSON report: %s\n", err)
+		}
+		if config.jsonReport == "-" {
+			return
+		}
+	}
+
 	var buffer bytes.Buffer
 
-	config := context.config
-	responseTimeData := stats.responseTimeData
+	responseTimes := stats.responseTimes
 	totalFailedReqeusts := stats.totalFailedReqeusts
 	totalRequests := stats.totalRequests
 	totalExecutionTime := stats.totalExecutionTime
 	totalResponseTime := stats.totalResponseTime
 	totalReceived := stats.totalReceived
+	unit := config.timeUnit.resolve(responseTimes)
 
 	URL, _ := url.Parse(config.url)
 
 	fmt.Fprint(&buffer, "\n\n")
 	fmt.Fprintf(&buffer, "Server Software:        %s\n", context.GetString(FieldServerName))
-	fmt.Fprintf(&buffer, "Server Hostname:        %s\n", config.host)
-	fmt.Fprintf(&buffer, "Server Port:            %d\n\n", config.port)
+	if config.unixSocket != "" {
+		fmt.Fprintf(&buffer, "Server Socket:          %s\n\n", config.unixSocket)
+	} else {
+		fmt.Fprintf(&buffer, "Server Hostname:        %s\n", config.host)
+		fmt.Fprintf(&buffer, "Server Port:            %d\n\n", config.port)
+	}
 
-	fmt.Fprintf(&buffer, "Document Path:          %s\n", URL.RequestURI())
-	fmt.Fprintf(&buffer, "Document Length:        %d bytes\n\n", context.GetInt(FieldContentSize))
+	if state, ok := context.GetValue(FieldTLSState).(*tls.ConnectionState); ok {
+		printTLSState(&buffer, state)
+	}
+
+	if config.IsGRPC() {
+		fmt.Fprintf(&buffer, "gRPC Method:            %s\n", config.grpcMethod)
+	} else {
+		fmt.Fprintf(&buffer, "Document Path:          %s\n", URL.RequestURI())
+	}
+	fmt.Fprintf(&buffer, "Document Length:        %d bytes\n", context.GetInt(FieldContentSize))
+	if config.body != nil {
+		fmt.Fprintf(&buffer, "Request Body:           %s\n", config.body)
+	}
+	if config.form != nil {
+		fmt.Fprintf(&buffer, "Request Body:           %s\n", config.form)
+	}
+	if config.auth != nil {
+		fmt.Fprintf(&buffer, "Authentication:         %s\n", config.auth)
+	}
+	if config.bodyEncoding != "" {
+		fmt.Fprintf(&buffer, "Request Encoding:       %s\n", config.bodyEncoding)
+	}
+	if config.gzip {
+		fmt.Fprintf(&buffer, "Accept Encoding:        %s\n", strings.Join(config.acceptEncodings, ", "))
+	}
+	fmt.Fprint(&buffer, "\n")
 
 	fmt.Fprintf(&buffer, "Concurrency Level:      %d\n", config.concurrency)
+	if config.proxy != nil {
+		mode := "forward"
+		if config.proxy.Tunnel(URL.Scheme) {
+			mode = "tunnel"
+		}
+		fmt.Fprintf(&buffer, "Proxy:                  %s (%s)\n", config.proxy, mode)
+	}
+	if config.pool != nil {
+		fmt.Fprintf(&buffer, "Connection Pool:        %s\n", config.pool)
+	}
+	if config.redirect != nil && !config.rawHTTP && !config.IsGRPC() {
+		fmt.Fprintf(&buffer, "Redirects:              %s\n", config.redirect)
+	}
+	if config.tcpOptions != nil {
+		fmt.Fprintf(&buffer, "TCP Options:            %s\n", config.tcpOptions)
+	}
+	if config.sourceAddrs != nil {
+		fmt.Fprintf(&buffer, "Source Addresses:       %d\n", config.sourceAddrs.Len())
+	}
+	if config.rawHTTP {
+		fmt.Fprintf(&buffer, "Pipeline Depth:         %d (raw HTTP/1.1 engine)\n", config.pipeline)
+	}
 	fmt.Fprintf(&buffer, "Time taken for tests:   %.6f seconds\n", totalExecutionTime.Seconds())
-	fmt.Fprintf(&buffer, "Time taken in millis:   %d ms\n", int64(totalResponseTime)/int64(time.Millisecond))
+	fmt.Fprintf(&buffer, "Total response time:    %s [%s]\n", unit.Format(totalResponseTime), unit)
 	fmt.Fprintf(&buffer, "Complete requests:      %d\n", totalRequests)
 	fmt.Fprintf(&buffer, "Success requests:       %d\n", stats.totalSuccess)
 	if totalFailedReqeusts == 0 {
@@ -57,57 +123,111 @@ func PrintReport(context *Context, stats *Stats) {
 	} else {
 		fmt.Fprintf(&buffer, "Failed requests:        %d\n", totalFailedReqeusts)
 
-		fmt.Fprint(&buffer, "Failed types and avg Query Times(ms)\n")
-		fmt.Fprint(&buffer, "       \tSuccess\tConnect\tReceive\tResponse Length\tExceptions\n")
-		fmt.Fprintf(&buffer, "Total:\t%d \t%d \t%d \t%d \t %d \t%d\n",
-			stats.totalSuccess, stats.errConnect, stats.errReceive, stats.errResponse, stats.errLength, stats.errException)
-		fmt.Fprintf(&buffer, "Times:\t%.2f\t%.2f\t%.2f\t%.2f\t %.2f\t%.2f\n",
-			div(stats.totalResponseTime, stats.totalSuccess),
-			div(stats.errConnectDur, stats.errConnect),
-			div(stats.errReceiveDur, stats.errReceive),
-			div(stats.errResponseDur, stats.errResponse),
-			div(stats.errLengthDur, stats.errLength),
-			div(stats.errExceptionDur, stats.errException))
-
-		fmt.Fprintf(&buffer, "   (Connect: %d, Receive: %d, Response: %d, Length: %d, Exceptions: %d)\n", stats.errConnect, stats.errReceive, stats.errResponse, stats.errLength, stats.errException)
+		fmt.Fprintf(&buffer, "Failed types and avg Query Times(%s)\n", unit)
+		fmt.Fprint(&buffer, "       \tSuccess\tConnect\tReceive\tResponse Length\tTimeout\tExceptions\n")
+		fmt.Fprintf(&buffer, "Total:\t%d \t%d \t%d \t%d \t %d \t%d \t%d\n",
+			stats.totalSuccess, stats.errConnect, stats.errReceive, stats.errResponse, stats.errLength, stats.errTimeout, stats.errException)
+		fmt.Fprintf(&buffer, "Times:\t%s\t%s\t%s\t%s\t %s\t%s\t%s\n",
+			unit.Format(avg(stats.totalResponseTime, stats.totalSuccess)),
+			unit.Format(avg(stats.errConnectDur, stats.errConnect)),
+			unit.Format(avg(stats.errReceiveDur, stats.errReceive)),
+			unit.Format(avg(stats.errResponseDur, stats.errResponse)),
+			unit.Format(avg(stats.errLengthDur, stats.errLength)),
+			unit.Format(avg(stats.errTimeoutDur, stats.errTimeout)),
+			unit.Format(avg(stats.errExceptionDur, stats.errException)))
+
+		fmt.Fprintf(&buffer, "   (Connect: %d, Receive: %d, Response: %d, Length: %d, Timeout: %d, Exceptions: %d)\n", stats.errConnect, stats.errReceive, stats.errResponse, stats.errLength, stats.errTimeout, stats.errException)
+		printErrorKinds(&buffer, stats)
+	}
+	if stats.errPortExhausted > 0 {
+		fmt.Fprintf(&buffer, "Port exhausted:         %d (local address not available, add source addresses with -source)\n", stats.errPortExhausted)
+	}
+	if len(stats.statusCodes) > 0 {
+		printStatusCodes(&buffer, config, stats, unit)
+	}
+	if stats.redirected > 0 {
+		printRedirectStats(&buffer, stats, unit)
+	}
+	if len(stats.grpcCodes) > 0 {
+		printGRPCCodes(&buffer, stats, unit)
+	}
+	if config.tlsHandshake {
+		printHandshakeStats(&buffer, config, stats, unit)
 	}
-	if stats.errResponse > 0 {
-		fmt.Fprintf(&buffer, "Non-2xx responses:      %d\n", stats.errResponse)
+	if len(stats.remoteAddrs) > 0 {
+		printRemoteAddrStats(&buffer, stats, unit)
 	}
+	if config.proxy != nil {
+		printProxyStats(&buffer, stats, unit)
+	}
+	printConnStats(&buffer, stats, unit)
 	fmt.Fprintf(&buffer, "HTML transferred:       %d bytes\n", totalReceived)
+	if stats.totalWire > 0 && totalReceived > 0 && stats.totalWire != totalReceived {
+		fmt.Fprintf(&buffer, "Wire transferred:       %d bytes (%.2f%% of decoded)\n", stats.totalWire, float64(stats.totalWire)*100/float64(totalReceived))
+	}
+	if stats.totalSent > 0 {
+		fmt.Fprintf(&buffer, "Body sent:              %d bytes\n", stats.totalSent)
+	}
+	if stats.totalEncoded > 0 {
+		fmt.Fprintf(&buffer, "Encoding time:          %s [%s] (mean), %s [%s] total of %d request bodies\n",
+			unit.Format(avg(stats.totalEncodeTime, stats.totalEncoded)), unit, unit.Format(stats.totalEncodeTime), unit, stats.totalEncoded)
+	}
+	if stats.totalDecoded > 0 {
+		fmt.Fprintf(&buffer, "Decoding time:          %s [%s] (mean), %s [%s] total of %d responses\n",
+			unit.Format(avg(stats.totalDecodeTime, stats.totalDecoded)), unit, unit.Format(stats.totalDecodeTime), unit, stats.totalDecoded)
+	}
 
-	if len(responseTimeData) > 0 && totalResponseTime > 0 {
-		//var datacount = len(responseTimeData)
-		stdDevOfResponseTime := stdDev(responseTimeData) / 1000000
-		sort.Sort(durationSlice(responseTimeData))
-
-		meanOfResponseTime := int64(totalResponseTime) / int64(totalRequests-totalFailedReqeusts) / 1000000
-		medianOfResponseTime := responseTimeData[len(responseTimeData)/2] / 1000000
-		minResponseTime := responseTimeData[0] / 1000000
-		maxResponseTime := responseTimeData[len(responseTimeData)-1] / 1000000
+	if responseTimes != nil && responseTimes.TotalCount() > 0 && totalResponseTime > 0 {
+		stdDevOfResponseTime := responseTimes.StdDev()
+		meanOfResponseTime := totalResponseTime / time.Duration(totalRequests-totalFailedReqeusts)
+		medianOfResponseTime := responseTimes.Percentile(50)
+		minResponseTime := responseTimes.Min()
+		maxResponseTime := responseTimes.Max()
+		timePerRequest := time.Duration(float64(totalExecutionTime) / float64(totalRequests))
 
 		fmt.Fprintf(&buffer, "Requests per second:    %.2f [#/sec] (mean)\n", float64(totalRequests)/totalExecutionTime.Seconds())
-		fmt.Fprintf(&buffer, "Time per request:       %.3f [ms] (mean)\n", float64(config.concurrency)*float64(totalExecutionTime.Nanoseconds())/1000000/float64(totalRequests))
-		fmt.Fprintf(&buffer, "Time per request:       %.3f [ms] (mean, across all concurrent requests)\n", float64(totalExecutionTime.Nanoseconds())/1000000/float64(totalRequests))
-		fmt.Fprintf(&buffer, "HTML Transfer rate:     %.2f [Kbytes/sec] received\n\n", float64(totalReceived/1024)/totalExecutionTime.Seconds())
+		fmt.Fprintf(&buffer, "Time per request:       %s [%s] (mean)\n", unit.Format(timePerRequest*time.Duration(config.concurrency)), unit)
+		fmt.Fprintf(&buffer, "Time per request:       %s [%s] (mean, across all concurrent requests)\n", unit.Format(timePerRequest), unit)
+		fmt.Fprintf(&buffer, "HTML Transfer rate:     %.2f [Kbytes/sec] received\n", float64(totalReceived/1024)/totalExecutionTime.Seconds())
+		if stats.totalSent > 0 {
+			fmt.Fprintf(&buffer, "Upload Transfer rate:   %.2f [Kbytes/sec] sent\n", float64(stats.totalSent/1024)/totalExecutionTime.Seconds())
+		}
+		fmt.Fprint(&buffer, "\n")
 
-		fmt.Fprint(&buffer, "Connection Times (ms)\n")
+		fmt.Fprintf(&buffer, "Connection Times (%s)\n", unit)
 		fmt.Fprint(&buffer, "              min\tmean[+/-sd]\t\tmedian\tmax\n")
-		fmt.Fprintf(&buffer, "Total:        %d     \t%d   ±%.2f \t %d \t%d\n\n",
-			minResponseTime,
-			meanOfResponseTime,
-			stdDevOfResponseTime,
-			medianOfResponseTime,
-			maxResponseTime)
-
-		fmt.Fprintln(&buffer, "Percentage of the requests served within a certain time (ms)")
-
-		percentages := []int{50, 66, 75, 80, 90, 95, 98, 99}
-
-		for _, percentage := range percentages {
-			fmt.Fprintf(&buffer, " %d%%\t %d\n", percentage, responseTimeData[percentage*len(responseTimeData)/100]/1000000)
+		fmt.Fprintf(&buffer, "Total:        %s     \t%s   ±%s \t %s \t%s\n\n",
+			unit.Format(minResponseTime),
+			unit.Format(meanOfResponseTime),
+			unit.Format(stdDevOfResponseTime),
+			unit.Format(medianOfResponseTime),
+			unit.Format(maxResponseTime))
+
+		fmt.Fprintf(&buffer, "Percentage of the requests served within a certain time (%s)\n", unit)
+
+		percentiles := config.percentiles
+		if len(percentiles) == 0 {
+			percentiles = DefaultPercentiles
+		}
+		for _, percentile := range percentiles {
+			fmt.Fprintf(&buffer, " %s%%\t %s\n", strconv.FormatFloat(percentile, 'f', -1, 64), unit.Format(responseTimes.Percentile(percentile)))
 		}
-		fmt.Fprintf(&buffer, " %d%%\t %d (longest request)\n", 100, maxResponseTime)
+		fmt.Fprintf(&buffer, " %d%%\t %s (longest request)\n", 100, unit.Format(maxResponseTime))
+	}
+	if totalRequests > 0 && (config.apdexT > 0 || len(config.sloTargets) > 0) {
+		fmt.Fprint(&buffer, "\n")
+		printApdex(&buffer, config, stats)
+	}
+	if len(stats.intervals) > 0 {
+		fmt.Fprint(&buffer, "\n")
+		printIntervals(&buffer, config, stats, unit)
+	} else if len(stats.scrapes) > 0 {
+		fmt.Fprint(&buffer, "\n")
+		printScrapes(&buffer, config, stats)
+	}
+	if stats.client != nil {
+		fmt.Fprint(&buffer, "\n")
+		printClientStats(&buffer, stats, unit)
 	}
 	fmt.Println(buffer.String())
 
@@ -119,25 +239,16 @@ func PrintReport(context *Context, stats *Stats) {
 	//	}
 }
 
-type durationSlice []time.Duration
-
-func (s durationSlice) Len() int           { return len(s) }
-func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
-func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-
-// StdDev calculate standard deviation
-func stdDev(data []time.Duration) float64 {
-	var sum int64
-	for _, d := range data {
-		sum += int64(d)
+func printGRPCCodes(buffer *bytes.Buffer, stats *Stats, unit TimeUnit) {
+	var codeList []int
+	for code := range stats.grpcCodes {
+		codeList = append(codeList, int(code))
 	}
-	avg := float64(sum / int64(len(data)))
-
-	sumOfSquares := 0.0
-	for _, d := range data {
+	sort.Ints(codeList)
 
-		sumOfSquares += math.Pow(float64(d)-avg, 2)
+	fmt.Fprintf(buffer, "gRPC status codes and avg Query Times(%s)\n", unit)
+	for _, c := range codeList {
+		code := codes.Code(c)
+		fmt.Fprintf(buffer, "  %-20s\t%d\t%s\n", code.String()+":", stats.grpcCodes[code], unit.Format(avg(stats.grpcCodesDur[code], stats.grpcCodes[code])))
 	}
-	return math.Sqrt(sumOfSquares / float64(len(data)))
-
 }
@@ -12,7 +12,11 @@ func TestStdDev(t *testing.T) {
 	}
 
 	for expectedData, testingData := range testData {
-		if result := stdDev(testingData); int(result*1000) != int(expectedData*1000) {
+		h := newResponseTimeHistogram()
+		for _, d := range testingData {
+			h.Record(d * time.Millisecond)
+		}
+		if result := MillisecondTimeUnit.Value(h.StdDev()); int(result*1000) != int(expectedData*1000) {
 			t.Errorf("expected %f, got %f", expectedData, result)
 		}
 	}
@@ -0,0 +1,153 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+const (
+	// ClientSampleInterval is how often gb samples its own resource usage.
+	ClientSampleInterval = 500 * time.Millisecond
+
+	// the load generator looks saturated above these
+	SaturationCPU        = 90.0                  // percent of GOMAXPROCS cores
+	SaturationGCPause    = 5.0                   // percent of the run time
+	SaturationQueueDelay = 10 * time.Millisecond // 99th percentile of the queueing delays
+	SaturationGoroutines = 10                    // goroutines per worker more than at the start
+)
+
+// ClientStats is the resource usage of gb itself during the run.
+type ClientStats struct {
+	cpuMax          float64
+	goroutinesStart int
+	goroutinesMax   int
+	heapMax         uint64
+	gcCount         uint32
+	gcPause         time.Duration
+	gcPauseMax      time.Duration
+
+	workers   int
+	start     time.Time
+	cpuStart  time.Duration
+	last      time.Time
+	cpuLast   time.Duration
+	cpuOK     bool
+	numGC     uint32
+	pauseNsGC uint64
+}
+
+func newClientStats(start time.Time, workers int) *ClientStats {
+	c := &ClientStats{workers: workers, start: start, last: start}
+	c.cpuStart, c.cpuOK = processCPUTime()
+	c.cpuLast = c.cpuStart
+	c.goroutinesStart = runtime.NumGoroutine()
+	c.goroutinesMax = c.goroutinesStart
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	c.numGC = mem.NumGC
+	c.pauseNsGC = mem.PauseTotalNs
+	return c
+}
+
+// sample takes the resource usage since the last sample at now.
+func (c *ClientStats) sample(now time.Time) {
+	if cpu, ok := processCPUTime(); ok && c.cpuOK && now.After(c.last) {
+		usage := cpuPercent(cpu-c.cpuLast, now.Sub(c.last))
+		c.cpuMax = max(c.cpuMax, usage)
+		c.cpuLast = cpu
+	}
+	c.last = now
+
+	c.goroutinesMax = max(c.goroutinesMax, runtime.NumGoroutine())
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	c.heapMax = max(c.heapMax, mem.HeapAlloc)
+
+	c.gcPauseMax = max(c.gcPauseMax, maxGCPause(&mem, c.numGC))
+	c.gcCount += mem.NumGC - c.numGC
+	c.gcPause += time.Duration(mem.PauseTotalNs - c.pauseNsGC)
+	c.numGC = mem.NumGC
+	c.pauseNsGC = mem.PauseTotalNs
+}
+
+// maxGCPause is the longest pause of the collections after the numGC-th one,
+// only the pauses of the last 256 collections are kept by the runtime.
+func maxGCPause(mem *runtime.MemStats, numGC uint32) (pause time.Duration) {
+	first := numGC + 1
+	if kept := uint32(len(mem.PauseNs)); mem.NumGC > kept {
+		first = max(first, mem.NumGC-kept+1)
+	}
+	for n := first; n <= mem.NumGC; n++ {
+		pause = max(pause, time.Duration(mem.PauseNs[(n+255)%256]))
+	}
+	return
+}
+
+// cpuPercent is the usage of used CPU time in elapsed time of all cores
+// available to the go runtime.
+func cpuPercent(used time.Duration, elapsed time.Duration) float64 {
+	return float64(used) * 100 / float64(elapsed) / float64(runtime.GOMAXPROCS(0))
+}
+
+// CPU is the mean CPU usage of the run.
+func (c *ClientStats) CPU() float64 {
+	if !c.cpuOK || !c.last.After(c.start) {
+		return 0
+	}
+	return cpuPercent(c.cpuLast-c.cpuStart, c.last.Sub(c.start))
+}
+
+// GCPausePercent is the percentage of the run spent in GC pauses.
+func (c *ClientStats) GCPausePercent() float64 {
+	if !c.last.After(c.start) {
+		return 0
+	}
+	return float64(c.gcPause) * 100 / float64(c.last.Sub(c.start))
+}
+
+// Warnings explains why the load generator looks saturated, if it does.
+// queueDelays may be nil, only the HTTP workers queue jobs with their time.
+func (c *ClientStats) Warnings(queueDelays *Histogram) (warnings []string) {
+	if c.CPU() > SaturationCPU {
+		warnings = append(warnings, fmt.Sprintf("gb used %.1f%% of CPU (%.1f%% at peak), the results may be limited by the client", c.CPU(), c.cpuMax))
+	}
+	if c.GCPausePercent() > SaturationGCPause {
+		warnings = append(warnings, fmt.Sprintf("gb spent %.1f%% of the run in GC pauses, the results may be limited by the client", c.GCPausePercent()))
+	}
+	if queueDelays != nil && queueDelays.TotalCount() > 0 && queueDelays.Percentile(99) > SaturationQueueDelay {
+		warnings = append(warnings, fmt.Sprintf("99%% of the requests waited up to %s to be sent, the results may be limited by the client", queueDelays.Percentile(99)))
+	}
+	if growth := c.goroutinesMax - c.goroutinesStart; c.workers > 0 && growth > SaturationGoroutines*c.workers {
+		warnings = append(warnings, fmt.Sprintf("gb grew from %d to %d goroutines for %d workers, the results may be limited by the client", c.goroutinesStart, c.goroutinesMax, c.workers))
+	}
+	return
+}
+
+func updateQueueStats(stats *Stats, record *Record) {
+	if stats.queueDelays == nil {
+		stats.queueDelays = newResponseTimeHistogram()
+	}
+	stats.queueDelays.Record(record.queueDelay)
+}
+
+func printClientStats(buffer *bytes.Buffer, stats *Stats, unit TimeUnit) {
+	c := stats.client
+	fmt.Fprint(buffer, "Client Resource Usage\n")
+	if c.cpuOK {
+		fmt.Fprintf(buffer, "  CPU:                  %.1f%% (mean), %.1f%% (max) of %d cores\n", c.CPU(), c.cpuMax, runtime.GOMAXPROCS(0))
+	}
+	fmt.Fprintf(buffer, "  Goroutines:           %d (max)\n", c.goroutinesMax)
+	fmt.Fprintf(buffer, "  Heap:                 %.2f MB (max)\n", float64(c.heapMax)/1024/1024)
+	fmt.Fprintf(buffer, "  GC Pauses:            %d, %s [%s] total (%.2f%% of run), %s [%s] max\n", c.gcCount, unit.Format(c.gcPause), unit, c.GCPausePercent(), unit.Format(c.gcPauseMax), unit)
+	if q := stats.queueDelays; q != nil && q.TotalCount() > 0 {
+		fmt.Fprintf(buffer, "  Queueing Delay:       %s [%s] (mean), %s [%s] (99%%), %s [%s] (max)\n",
+			unit.Format(q.Mean()), unit, unit.Format(q.Percentile(99)), unit, unit.Format(q.Max()), unit)
+	}
+	for _, warning := range c.Warnings(stats.queueDelays) {
+		fmt.Fprintf(buffer, "WARNING: %s\n", warning)
+	}
+}
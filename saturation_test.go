@@ -0,0 +1,182 @@
+package gb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientStats(t *testing.T) {
+	start := time.Now()
+	c := newClientStats(start, 1)
+
+	// keep a core busy and collect garbage
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+	}
+	runtime.GC()
+	runtime.GC()
+	c.sample(time.Now())
+
+	if c.cpuOK && (c.CPU() <= 0 || c.cpuMax <= 0) {
+		t.Errorf("expected CPU usage, got %.2f%% (%.2f%% max)", c.CPU(), c.cpuMax)
+	}
+	if c.gcCount < 2 || c.gcPause <= 0 || c.gcPauseMax <= 0 || c.gcPauseMax > c.gcPause {
+		t.Errorf("expected 2 GC pauses, got %d of %s (%s max)", c.gcCount, c.gcPause, c.gcPauseMax)
+	}
+	if c.goroutinesMax < 1 || c.heapMax == 0 {
+		t.Errorf("expected goroutines and heap, got %d and %d", c.goroutinesMax, c.heapMax)
+	}
+}
+
+func TestClientStatsWarnings(t *testing.T) {
+	start := time.Now()
+	c := &ClientStats{start: start, last: start.Add(time.Second), cpuOK: true}
+	if warnings := c.Warnings(nil); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+
+	c.cpuLast = time.Duration(runtime.GOMAXPROCS(0)) * 950 * time.Millisecond
+	c.gcPause = 100 * time.Millisecond
+	if warnings := c.Warnings(nil); len(warnings) != 2 || !strings.Contains(warnings[0], "95.0% of CPU") || !strings.Contains(warnings[1], "10.0% of the run") {
+		t.Fatalf("expected CPU and GC warnings, got %v", warnings)
+	}
+
+	// the workers of gRPC, -raw and -handshake don't queue jobs with their
+	// time
+	var buffer bytes.Buffer
+	printClientStats(&buffer, &Stats{client: c}, MillisecondTimeUnit)
+	if strings.Contains(buffer.String(), "Queueing Delay") {
+		t.Errorf("expected no queueing delay without HTTP workers:\n%s", buffer.String())
+	}
+
+	stats := &Stats{client: c}
+	updateQueueStats(stats, &Record{queueDelay: 2 * time.Millisecond})
+	buffer.Reset()
+	printClientStats(&buffer, stats, MillisecondTimeUnit)
+	for _, line := range []string{"  CPU:                  95.0% (mean)", "  Queueing Delay:       2.000 [ms] (mean)", "WARNING: gb used 95.0% of CPU"} {
+		if !strings.Contains(buffer.String(), line) {
+			t.Errorf("expected %q in the client resource usage:\n%s", line, buffer.String())
+		}
+	}
+}
+
+func TestClientStatsQueueAndGoroutineWarnings(t *testing.T) {
+	start := time.Now()
+	c := &ClientStats{workers: 4, goroutinesStart: 10, goroutinesMax: 50, start: start, last: start.Add(time.Second)}
+	queueDelays := newResponseTimeHistogram()
+	for i := 0; i < 100; i++ {
+		queueDelays.Record(time.Millisecond)
+	}
+	if warnings := c.Warnings(queueDelays); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+
+	c.goroutinesMax = 51
+	for i := 0; i < 2; i++ {
+		queueDelays.Record(50 * time.Millisecond)
+	}
+	if warnings := c.Warnings(queueDelays); len(warnings) != 2 || !strings.Contains(warnings[0], "waited up to 50ms") || !strings.Contains(warnings[1], "from 10 to 51 goroutines for 4 workers") {
+		t.Fatalf("expected queueing delay and goroutine warnings, got %v", warnings)
+	}
+}
+
+func TestQueueDelayOfRunCustom(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      2,
+		requests:         20,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	// RunCustom queues all of jobs before the run starts, the delay must
+	// not grow with the time they wait for the earlier jobs to be answered
+	go benchmark.RunCustom(nil)
+	context.start.Wait()
+	context.startRun.Done()
+
+	var highest time.Duration
+	for i := 0; i < config.requests; i++ {
+		record := <-benchmark.Collector
+		if record.Error != nil {
+			t.Fatalf("send http request failed: %s", record.Error)
+		}
+		highest = max(highest, record.queueDelay)
+	}
+	close(context.stop)
+
+	if highest <= 0 || highest >= 20*time.Millisecond {
+		t.Fatalf("expected queueing delays below a response time of 20ms, got %s at most", highest)
+	}
+}
+
+func TestQueueDelayOfLateJob(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         1,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	request, err := NewHTTPRequest(config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+
+	// the worker is ready long before the job is queued
+	time.Sleep(50 * time.Millisecond)
+	jobs <- NewHTTPJob(request)
+	record := <-collector
+	close(jobs)
+	close(context.stop)
+
+	if record.queueDelay <= 0 || record.queueDelay >= 50*time.Millisecond {
+		t.Fatalf("expected the delay since the job is queued, got %s", record.queueDelay)
+	}
+}
+
+func TestMaxGCPause(t *testing.T) {
+	// 1000 collections since the last sample, the pauses of the last 256 are
+	// kept in a circular buffer
+	mem := &runtime.MemStats{NumGC: 1000}
+	for n := uint32(745); n <= 1000; n++ {
+		mem.PauseNs[(n+255)%256] = uint64(n)
+	}
+	if pause := maxGCPause(mem, 0); pause != 1000 {
+		t.Fatalf("expected the longest of the kept pauses, got %d", pause)
+	}
+
+	mem.PauseNs[(1000+255)%256] = 1
+	if pause := maxGCPause(mem, 998); pause != 999 {
+		t.Fatalf("expected the longest pause of the last 2 collections, got %d", pause)
+	}
+	if pause := maxGCPause(mem, 1000); pause != 0 {
+		t.Fatalf("expected no pause without collections, got %d", pause)
+	}
+}
@@ -0,0 +1,347 @@
+package gb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	DefaultScrapeSeries   = "rate(process_cpu_seconds_total),go_goroutines"
+	DefaultScrapeInterval = time.Second
+)
+
+// ScrapeSample is the values of the scraped series at elapsed time of the
+// run.
+type ScrapeSample struct {
+	elapsed time.Duration
+	values  map[string]float64
+	err     error
+}
+
+// Scraper polls a Prometheus /metrics or an expvar /debug/vars endpoint of
+// the server under test during the run.
+//
+// Series are Prometheus metric names with optional labels to match, eg.
+// 'http_requests_total{code="500"}', values of every matching label set are
+// summed. Expvar series are dotted paths, eg. 'memstats.HeapAlloc'. A series
+// in rate(...) is recorded as the per second rate between scrapes.
+type Scraper struct {
+	URL    string
+	Series []string
+
+	client *http.Client
+
+	mu      sync.Mutex
+	samples []*ScrapeSample
+	last    map[string]float64
+	lastAt  time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewScraper(config *Config, url string, series []string) *Scraper {
+	return &Scraper{
+		URL:    url,
+		Series: series,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: newClientTLSConfig(config)},
+			Timeout:   MaxExecutionTimeout,
+		},
+	}
+}
+
+// Start scrapes every interval until Stop is called.
+func (s *Scraper) Start(start time.Time, interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.scrape(start, time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				s.scrape(start, now)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops scraping and returns all of samples.
+func (s *Scraper) Stop() []*ScrapeSample {
+	close(s.stop)
+	<-s.done
+	return s.Samples()
+}
+
+func (s *Scraper) Samples() []*ScrapeSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ScrapeSample(nil), s.samples...)
+}
+
+// Latest returns the values of the last successful scrape.
+func (s *Scraper) Latest() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.samples) - 1; i >= 0; i-- {
+		if s.samples[i].err == nil {
+			return s.samples[i].values
+		}
+	}
+	return nil
+}
+
+func (s *Scraper) scrape(start time.Time, now time.Time) {
+	raw, err := s.Scrape()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := &ScrapeSample{elapsed: now.Sub(start), err: err}
+	if err == nil {
+		sample.values = make(map[string]float64, len(s.Series))
+		for _, series := range s.Series {
+			name, rate := rateOf(series)
+			value, ok := raw[name]
+			if !ok {
+				continue
+			}
+			if !rate {
+				sample.values[series] = value
+			} else if previous, ok := s.last[name]; ok && now.After(s.lastAt) {
+				sample.values[series] = (value - previous) / now.Sub(s.lastAt).Seconds()
+			}
+		}
+		s.last = raw
+		s.lastAt = now
+	}
+	s.samples = append(s.samples, sample)
+}
+
+// Scrape fetches the current raw values of series.
+func (s *Scraper) Scrape() (map[string]float64, error) {
+	response, err := s.client.Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("scrape failed: " + response.Status)
+	}
+
+	names := make([]string, len(s.Series))
+	for i, series := range s.Series {
+		names[i], _ = rateOf(series)
+	}
+
+	body := bufio.NewReader(response.Body)
+	if first, err := body.Peek(1); err == nil && first[0] == '{' {
+		return parseExpvar(body, names)
+	}
+	return parsePrometheus(body, names)
+}
+
+func rateOf(series string) (string, bool) {
+	if strings.HasPrefix(series, "rate(") && strings.HasSuffix(series, ")") {
+		return series[5 : len(series)-1], true
+	}
+	return series, false
+}
+
+// parsePrometheus parses the Prometheus text format and returns the values
+// of series.
+func parsePrometheus(r io.Reader, series []string) (map[string]float64, error) {
+	type matcher struct {
+		series string
+		name   string
+		labels map[string]string
+	}
+	var matchers []matcher
+	seen := make(map[string]bool)
+	for _, s := range series {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		name, labels, err := splitPrometheusSeries(s)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher{s, name, labels})
+	}
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// name{labels} value [timestamp]
+		end := strings.LastIndex(line, "}") + 1
+		if end == 0 {
+			end = strings.IndexAny(line, " \t")
+		}
+		if end <= 0 {
+			continue
+		}
+		fields := strings.Fields(line[end:])
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || math.IsNaN(value) {
+			continue
+		}
+		name, labels, err := splitPrometheusSeries(line[:end])
+		if err != nil {
+			continue
+		}
+
+	match:
+		for _, m := range matchers {
+			if m.name != name {
+				continue
+			}
+			for key, v := range m.labels {
+				if labels[key] != v {
+					continue match
+				}
+			}
+			values[m.series] += value
+		}
+	}
+	return values, scanner.Err()
+}
+
+// splitPrometheusSeries splits 'name{key="value",...}' into the name and
+// labels.
+func splitPrometheusSeries(s string) (string, map[string]string, error) {
+	i := strings.Index(s, "{")
+	if i < 0 {
+		return strings.TrimSpace(s), nil, nil
+	}
+	if !strings.HasSuffix(s, "}") {
+		return "", nil, errors.New("invalid series: " + s)
+	}
+
+	labels := make(map[string]string)
+	for _, pair := range splitList(s[i+1 : len(s)-1]) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, errors.New("invalid series: " + s)
+		}
+		value, err := strconv.Unquote(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return "", nil, errors.New("invalid series: " + s)
+		}
+		labels[strings.TrimSpace(kv[0])] = value
+	}
+	return strings.TrimSpace(s[:i]), labels, nil
+}
+
+// splitList splits s at commas outside of braces and quoted values.
+func splitList(s string) (items []string) {
+	quoted := false
+	depth := 0
+	begin := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case s[i] == '{':
+			depth++
+		case s[i] == '}':
+			depth--
+		case s[i] == ',' && depth == 0:
+			items = append(items, s[begin:i])
+			begin = i + 1
+		}
+	}
+	if strings.TrimSpace(s[begin:]) != "" {
+		items = append(items, s[begin:])
+	}
+	return
+}
+
+// parseExpvar parses the JSON of expvar and returns the numeric values of
+// dotted paths.
+func parseExpvar(r io.Reader, paths []string) (map[string]float64, error) {
+	var vars map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&vars); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64)
+	for _, path := range paths {
+		var v interface{} = vars
+		for _, key := range strings.Split(path, ".") {
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+			v = object[key]
+		}
+		if number, ok := v.(float64); ok {
+			values[path] = number
+		}
+	}
+	return values, nil
+}
+
+// printScrapes prints the samples of series when there are no interval
+// statistics to show them next to.
+func printScrapes(buffer *bytes.Buffer, config *Config, stats *Stats) {
+	fmt.Fprintf(buffer, "Server Metrics (%s)\n", config.scraper.URL)
+	fmt.Fprintf(buffer, "  Time(s)\t%s\n", strings.Join(config.scraper.Series, "\t"))
+
+	failed := 0
+	for _, sample := range stats.scrapes {
+		if sample.err != nil {
+			failed++
+			continue
+		}
+		fmt.Fprintf(buffer, "  %.1f%s\n", sample.elapsed.Seconds(), formatSeries(config.scraper.Series, sample.values))
+	}
+	if failed > 0 {
+		fmt.Fprintf(buffer, "  Failed scrapes: %d\n", failed)
+	}
+}
+
+// formatSeries formats values of series as tab separated columns, missing
+// ones are shown as '-'.
+func formatSeries(series []string, values map[string]float64) string {
+	var b strings.Builder
+	for _, s := range series {
+		if value, ok := values[s]; ok {
+			fmt.Fprintf(&b, "\t%s", strconv.FormatFloat(value, 'g', 6, 64))
+		} else {
+			b.WriteString("\t-")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParsePrometheus(t *testing.T) {
+	metrics := `# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 42
+process_cpu_seconds_total 12.5
+queue_depth{queue="jobs",shard="1"} 3
+queue_depth{queue="jobs",shard="2"} 4
+queue_depth{queue="mail, urgent"} 7 1712345678000
+`
+	values, err := parsePrometheus(strings.NewReader(metrics), []string{"go_goroutines", "process_cpu_seconds_total", `queue_depth{queue="jobs"}`, `queue_depth{queue="mail, urgent"}`, "queue_depth", "missing"})
+	if err != nil {
+		t.Fatalf("parse metrics failed: %s", err)
+	}
+
+	expected := map[string]float64{"go_goroutines": 42, "process_cpu_seconds_total": 12.5, `queue_depth{queue="jobs"}`: 7, `queue_depth{queue="mail, urgent"}`: 7, "queue_depth": 14}
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	items := splitList(`rate(process_cpu_seconds_total),queue_depth{queue="a,b",shard="1"}, go_goroutines`)
+	if len(items) != 3 || items[1] != `queue_depth{queue="a,b",shard="1"}` {
+		t.Fatalf("unexpected items %q", items)
+	}
+}
+
+func TestScraper(t *testing.T) {
+	var scrapes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&scrapes, 1)
+		if r.URL.Path == "/debug/vars" {
+			fmt.Fprintf(w, `{"goroutines": 10, "memstats": {"HeapAlloc": %d, "PauseNs": [1, 2]}}`, n*1024)
+			return
+		}
+		// a CPU second per scrape
+		fmt.Fprintf(w, "process_cpu_seconds_total %d\ngo_goroutines 10\n", n)
+	}))
+	defer ts.Close()
+
+	scraper := NewScraper(&Config{}, ts.URL+"/metrics", []string{"rate(process_cpu_seconds_total)", "go_goroutines"})
+	start := time.Now()
+	scraper.scrape(start, start)
+	scraper.scrape(start, start.Add(500*time.Millisecond))
+
+	samples := scraper.Samples()
+	if len(samples) != 2 || samples[0].values["rate(process_cpu_seconds_total)"] != 0 || samples[1].values["rate(process_cpu_seconds_total)"] != 2 {
+		t.Fatalf("expected a rate of 2 after the first scrape, got %v", samples)
+	}
+	if latest := scraper.Latest(); latest["go_goroutines"] != 10 {
+		t.Fatalf("expected 10 goroutines, got %v", latest)
+	}
+
+	expvar := NewScraper(&Config{}, ts.URL+"/debug/vars", []string{"goroutines", "memstats.HeapAlloc", "memstats.PauseNs"})
+	expvar.Start(time.Now(), 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	samples = expvar.Stop()
+	if len(samples) < 2 || samples[0].err != nil || samples[0].values["goroutines"] != 10 || samples[0].values["memstats.HeapAlloc"] == 0 {
+		t.Fatalf("unexpected expvar samples %v", samples[0])
+	}
+	if _, ok := samples[0].values["memstats.PauseNs"]; ok {
+		t.Fatal("expected non-numeric expvar to be skipped")
+	}
+
+	config := &Config{scraper: scraper}
+	var buffer bytes.Buffer
+	printScrapes(&buffer, config, &Stats{scrapes: scraper.Samples()})
+	if !strings.Contains(buffer.String(), "  Time(s)\trate(process_cpu_seconds_total)\tgo_goroutines\n  0.0\t-\t10\n  0.5\t2\t10\n") {
+		t.Fatalf("unexpected server metrics:\n%s", buffer.String())
+	}
+
+	config.interval = time.Second
+	buffer.Reset()
+	printIntervals(&buffer, config, &Stats{intervals: []*IntervalStats{{elapsed: time.Second, duration: time.Second, server: scraper.Latest()}}}, MillisecondTimeUnit)
+	if !strings.Contains(buffer.String(), "\tIn flight\trate(process_cpu_seconds_total)\tgo_goroutines\n") || !strings.HasSuffix(buffer.String(), "\t0\t2\t10\n") {
+		t.Fatalf("expected server metrics next to the time series:\n%s", buffer.String())
+	}
+}
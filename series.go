@@ -0,0 +1,118 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// IntervalStats are the statistics of requests completed in an interval of
+// the run.
+type IntervalStats struct {
+	elapsed  time.Duration // since the start of the run to the end of interval
+	duration time.Duration
+	requests int
+	errors   int
+	received int64
+	p50      time.Duration
+	p90      time.Duration
+	p99      time.Duration
+	inFlight int64
+	server   map[string]float64 // the latest scraped series of the server
+}
+
+func (s *IntervalStats) RPS() float64 {
+	return float64(s.requests) / s.duration.Seconds()
+}
+
+// ErrorRate is the percentage of failed requests.
+func (s *IntervalStats) ErrorRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.errors) * 100 / float64(s.requests)
+}
+
+func (s *IntervalStats) BytesPerSec() float64 {
+	return float64(s.received) / s.duration.Seconds()
+}
+
+func (s *IntervalStats) String() string {
+	return s.Format(AutoTimeUnit)
+}
+
+// Format formats the interval as a progress line, AutoTimeUnit picks the
+// unit by the median of the interval.
+func (s *IntervalStats) Format(unit TimeUnit) string {
+	if unit == AutoTimeUnit {
+		unit = autoTimeUnit(s.p50)
+	}
+	return fmt.Sprintf("[%6.1fs] %10.2f req/s  %6.2f%% errors  p50 %s %s  p90 %s %s  p99 %s %s  %10.2f KB/s  %d in flight",
+		s.elapsed.Seconds(), s.RPS(), s.ErrorRate(), unit.Format(s.p50), unit, unit.Format(s.p90), unit, unit.Format(s.p99), unit,
+		s.BytesPerSec()/1024, s.inFlight)
+}
+
+// intervalRecorder collects records of the current interval.
+type intervalRecorder struct {
+	runStart time.Time
+	start    time.Time
+	requests int
+	errors   int
+	received int64
+	latency  *Histogram
+}
+
+func newIntervalRecorder(start time.Time) *intervalRecorder {
+	return &intervalRecorder{runStart: start, start: start, latency: newResponseTimeHistogram()}
+}
+
+func (r *intervalRecorder) record(record *Record) {
+	r.requests++
+	if record.Error != nil {
+		r.errors++
+		return
+	}
+	r.received += record.contentSize
+	r.latency.Record(record.responseTime)
+}
+
+// flush ends the interval at now and starts the next one.
+func (r *intervalRecorder) flush(now time.Time, inFlight int64) *IntervalStats {
+	s := &IntervalStats{
+		elapsed:  now.Sub(r.runStart),
+		duration: now.Sub(r.start),
+		requests: r.requests,
+		errors:   r.errors,
+		received: r.received,
+		p50:      r.latency.Percentile(50),
+		p90:      r.latency.Percentile(90),
+		p99:      r.latency.Percentile(99),
+		inFlight: inFlight,
+	}
+
+	r.start = now
+	r.requests = 0
+	r.errors = 0
+	r.received = 0
+	r.latency.Reset()
+	return s
+}
+
+func printIntervals(buffer *bytes.Buffer, config *Config, stats *Stats, unit TimeUnit) {
+	fmt.Fprintf(buffer, "Time series (per %s)\n", config.interval)
+	var series []string
+	if config.scraper != nil {
+		series = config.scraper.Series
+	}
+
+	fmt.Fprintf(buffer, "  Time(s)\tReq/s\tErrors(%%)\tp50(%s)\tp90(%s)\tp99(%s)\tKB/s\tIn flight", unit, unit, unit)
+	for _, name := range series {
+		fmt.Fprintf(buffer, "\t%s", name)
+	}
+	fmt.Fprint(buffer, "\n")
+	for _, s := range stats.intervals {
+		fmt.Fprintf(buffer, "  %.1f\t%.2f\t%.2f\t%s\t%s\t%s\t%.2f\t%d%s\n",
+			s.elapsed.Seconds(), s.RPS(), s.ErrorRate(), unit.Format(s.p50), unit.Format(s.p90), unit.Format(s.p99), s.BytesPerSec()/1024, s.inFlight,
+			formatSeries(series, s.server))
+	}
+}
@@ -0,0 +1,55 @@
+package gb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntervalRecorder(t *testing.T) {
+	start := time.Now()
+	recorder := newIntervalRecorder(start)
+
+	for i := 1; i <= 100; i++ {
+		recorder.record(&Record{responseTime: time.Duration(i) * time.Millisecond, contentSize: 1024})
+	}
+	recorder.record(&Record{Error: &ConnectError{errors.New("refused")}})
+	recorder.record(&Record{Error: &ConnectError{errors.New("refused")}})
+
+	s := recorder.flush(start.Add(2*time.Second), 3)
+	if s.requests != 102 || s.errors != 2 || s.inFlight != 3 {
+		t.Fatalf("unexpected interval %+v", s)
+	}
+	if s.RPS() != 51 || s.BytesPerSec() != 51200 || int(s.ErrorRate()*100) != 196 {
+		t.Fatalf("unexpected rates %.2f req/s, %.2f bytes/s and %.2f%% errors", s.RPS(), s.BytesPerSec(), s.ErrorRate())
+	}
+	for expected, actual := range map[time.Duration]time.Duration{50 * time.Millisecond: s.p50, 90 * time.Millisecond: s.p90, 99 * time.Millisecond: s.p99} {
+		if actual < expected || actual > expected+expected/1000 {
+			t.Fatalf("expected percentile of %s, got %s", expected, actual)
+		}
+	}
+
+	// the next interval starts empty
+	s = recorder.flush(start.Add(3*time.Second), 0)
+	if s.elapsed != 3*time.Second || s.duration != time.Second || s.requests != 0 || s.p99 != 0 {
+		t.Fatalf("unexpected empty interval %+v", s)
+	}
+
+	var buffer bytes.Buffer
+	printIntervals(&buffer, &Config{interval: time.Second}, &Stats{intervals: []*IntervalStats{s}}, MillisecondTimeUnit)
+	if !strings.HasPrefix(buffer.String(), "Time series (per 1s)\n") || !strings.Contains(buffer.String(), "  3.0\t0.00\t0.00\t") {
+		t.Fatalf("unexpected time series:\n%s", buffer.String())
+	}
+}
+
+func TestContextInFlight(t *testing.T) {
+	context := NewContext(&Config{})
+	context.BeginRequest()
+	context.BeginRequest()
+	context.EndRequest()
+	if context.InFlight() != 1 {
+		t.Fatalf("expected 1 request in flight, got %d", context.InFlight())
+	}
+}
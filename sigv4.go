@@ -0,0 +1,181 @@
+package gb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+	sigV4TimeFormat      = "20060102T150405Z"
+)
+
+// SigV4 signs requests with AWS Signature Version 4.
+type SigV4 struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+
+	now func() time.Time
+}
+
+// NewSigV4 takes the scope as 'region:service', eg. 'us-east-1:execute-api'.
+// Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and the
+// optional AWS_SESSION_TOKEN.
+func NewSigV4(scope string) (*SigV4, error) {
+	pair := strings.SplitN(scope, ":", 2)
+	if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+		return nil, errors.New("SigV4 scope must be region:service - " + scope)
+	}
+
+	s := &SigV4{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Region:       pair[0],
+		Service:      pair[1],
+		now:          time.Now,
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("SigV4 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+func (s *SigV4) Authenticate(request *http.Request) error {
+	payloadHash, err := s.payloadHash(request)
+	if err != nil {
+		return err
+	}
+
+	t := s.now().UTC()
+	amzDate := t.Format(sigV4TimeFormat)
+	request.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	if s.Service == "s3" {
+		request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.Join(strings.Fields(headers[name]), " "))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		path,
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := amzDate[:8]
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.AccessKey, scope, signedHeaders, signature))
+	return nil
+}
+
+// payloadHash hashes the body when it can be read again, bodies streamed
+// once are only allowed to be unsigned by S3.
+func (s *SigV4) payloadHash(request *http.Request) (string, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return hashHex(nil), nil
+	}
+
+	if request.GetBody == nil {
+		if s.Service == "s3" {
+			return sigV4UnsignedPayload, nil
+		}
+		return "", errors.New("SigV4 signing requires a body which can be read again")
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *SigV4) String() string {
+	return "AWS SigV4 (" + s.Region + ", " + s.Service + ")"
+}
+
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key)+"="+sigV4Escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func sigV4Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package gb
+
+import (
+	"errors"
+)
+
+func setSocketBuffers(fd uintptr, sndbuf, rcvbuf int) error {
+	return errors.New("socket buffer sizes are not supported on this platform")
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package gb
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func getReceiveBuffer(conn *net.TCPConn) (size int, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	ctrlErr := raw.Control(func(fd uintptr) {
+		size, err = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	})
+	if ctrlErr != nil {
+		return 0, ctrlErr
+	}
+	return
+}
+
+func TestDialWithTCPOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	defer listener.Close()
+	go acceptAll(listener)
+
+	options := &TCPOptions{NoDelay: false, Linger: 0, ReceiveBuffer: 32768}
+	dial := NewDialer(&Config{tcpOptions: options})
+	conn, err := dial(context.Background(), "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	defer conn.Close()
+
+	rcvbuf, err := getReceiveBuffer(conn.(*net.TCPConn))
+	if err != nil {
+		t.Skipf("read SO_RCVBUF failed: %s", err)
+	}
+	// linux doubles the requested size for bookkeeping overhead
+	if rcvbuf != 32768 && rcvbuf != 2*32768 {
+		t.Fatalf("expected receive buffer of 32768 bytes, got %d", rcvbuf)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package gb
+
+import (
+	"syscall"
+)
+
+func setSocketBuffers(fd uintptr, sndbuf, rcvbuf int) error {
+	if sndbuf > 0 {
+		if err := syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, sndbuf); err != nil {
+			return err
+		}
+	}
+	if rcvbuf > 0 {
+		return syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, rcvbuf)
+	}
+	return nil
+}
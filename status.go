@@ -0,0 +1,110 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const DefaultSuccessCodes = "2xx"
+
+// StatusCodes is a set of HTTP status codes counted as success.
+type StatusCodes struct {
+	ranges [][2]int
+	spec   string
+}
+
+// ParseStatusCodes parses comma separated codes and ranges, eg.
+// '200-299,304' or '2xx,404'.
+func ParseStatusCodes(spec string) (*StatusCodes, error) {
+	s := &StatusCodes{spec: spec}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+
+		var low, high int
+		var err error
+		switch {
+		case len(item) == 3 && strings.HasSuffix(item, "xx"):
+			if low, err = strconv.Atoi(item[:1]); err == nil {
+				low *= 100
+				high = low + 99
+			}
+		case strings.Contains(item, "-"):
+			pair := strings.SplitN(item, "-", 2)
+			if low, err = strconv.Atoi(pair[0]); err == nil {
+				high, err = strconv.Atoi(pair[1])
+			}
+		default:
+			low, err = strconv.Atoi(item)
+			high = low
+		}
+
+		if err != nil || low < 100 || high > 599 || low > high {
+			return nil, errors.New("invalid status code or range: " + item)
+		}
+		s.ranges = append(s.ranges, [2]int{low, high})
+	}
+
+	if len(s.ranges) == 0 {
+		return nil, errors.New("no status code given")
+	}
+	return s, nil
+}
+
+// Match reports whether code counts as success, any 2xx code does when s is
+// nil.
+func (s *StatusCodes) Match(code int) bool {
+	if s == nil {
+		return code >= 200 && code <= 299
+	}
+	for _, r := range s.ranges {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *StatusCodes) String() string {
+	if s == nil {
+		return DefaultSuccessCodes
+	}
+	return s.spec
+}
+
+func updateStatusStats(stats *Stats, record *Record) {
+	if stats.statusCodes == nil {
+		stats.statusCodes = make(map[int]int)
+		stats.statusCodesDur = make(map[int]time.Duration)
+	}
+
+	stats.statusCodes[record.statusCode]++
+	stats.statusCodesDur[record.statusCode] += record.responseTime
+}
+
+func printStatusCodes(buffer *bytes.Buffer, config *Config, stats *Stats, unit TimeUnit) {
+	var codeList []int
+	for code := range stats.statusCodes {
+		codeList = append(codeList, code)
+	}
+	sort.Ints(codeList)
+
+	fmt.Fprintf(buffer, "Status codes and avg Query Times(%s), success: %s\n", unit, config.successCodes)
+	for _, code := range codeList {
+		result := "success"
+		if !config.successCodes.Match(code) {
+			result = "failed"
+		}
+		fmt.Fprintf(buffer, "  %-28s\t%d\t%s\t%s\n", fmt.Sprintf("%d %s:", code, http.StatusText(code)), stats.statusCodes[code], unit.Format(avg(stats.statusCodesDur[code], stats.statusCodes[code])), result)
+	}
+}
@@ -0,0 +1,88 @@
+package gb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	codes, err := ParseStatusCodes("2xx, 304,400-404")
+	if err != nil {
+		t.Fatalf("parse status codes failed: %s", err)
+	}
+
+	for code, expected := range map[int]bool{200: true, 299: true, 300: false, 304: true, 399: false, 400: true, 404: true, 405: false} {
+		if actual := codes.Match(code); actual != expected {
+			t.Errorf("expected %t for %d, got %t", expected, code, actual)
+		}
+	}
+
+	var defaults *StatusCodes
+	if !defaults.Match(204) || defaults.Match(304) {
+		t.Error("expected only 2xx codes to match by default")
+	}
+
+	for _, spec := range []string{"", "abc", "99", "600", "404-400", "6xx"} {
+		if _, err := ParseStatusCodes(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestHTTPWorkerWithSuccessCodes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer ts.Close()
+
+	successCodes, _ := ParseStatusCodes("2xx,304,404")
+	config := &Config{
+		concurrency:      1,
+		requests:         4,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		keepAlive:        true,
+		url:              ts.URL,
+		successCodes:     successCodes,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 0)
+	jobs := make(chan *HTTPJob)
+	collector := make(chan *Record)
+
+	worker := NewHTTPWorker(context, jobs, collector)
+	context.startRun.Done()
+	go worker.Run(0)
+
+	stats := &Stats{}
+	for _, code := range []string{"200", "304", "404", "500"} {
+		request, _ := http.NewRequest("GET", ts.URL+"?code="+code, nil)
+		jobs <- NewHTTPJob(request)
+		record := <-collector
+		updateStats(stats, record)
+		updateStatusStats(stats, record)
+	}
+	close(jobs)
+	close(context.stop)
+
+	if stats.totalSuccess != 3 || stats.errResponse != 1 {
+		t.Fatalf("expected 3 success and 1 failed response, got %d and %d", stats.totalSuccess, stats.errResponse)
+	}
+
+	var buffer bytes.Buffer
+	printStatusCodes(&buffer, config, stats, MillisecondTimeUnit)
+	for _, line := range []string{"304 Not Modified:", "404 Not Found:", "500 Internal Server Error:"} {
+		if !strings.Contains(buffer.String(), line) {
+			t.Errorf("expected %q in the status code table:\n%s", line, buffer.String())
+		}
+	}
+	if !strings.Contains(buffer.String(), "\tfailed\n") {
+		t.Errorf("expected 500 to be reported as failed:\n%s", buffer.String())
+	}
+}
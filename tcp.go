@@ -0,0 +1,111 @@
+package gb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TCPOptions are the socket options applied to every connection.
+type TCPOptions struct {
+	NoDelay        bool
+	Linger         int           // seconds, negative for the system default
+	KeepAlive      time.Duration // zero for the default period, negative to disable
+	SendBuffer     int           // bytes, zero for the system default
+	ReceiveBuffer  int           // bytes, zero for the system default
+	ConnectTimeout time.Duration // zero for no timeout
+}
+
+func DefaultTCPOptions() *TCPOptions {
+	return &TCPOptions{NoDelay: true, Linger: -1}
+}
+
+func (o *TCPOptions) newDialer() *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   o.ConnectTimeout,
+		KeepAlive: o.KeepAlive,
+	}
+
+	// buffer sizes must be set before connecting to take effect on the
+	// TCP window scale
+	if o.SendBuffer > 0 || o.ReceiveBuffer > 0 {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			var err error
+			ctrlErr := c.Control(func(fd uintptr) {
+				err = setSocketBuffers(fd, o.SendBuffer, o.ReceiveBuffer)
+			})
+			if ctrlErr != nil {
+				return ctrlErr
+			}
+			return err
+		}
+	}
+	return dialer
+}
+
+// wrap applies the options which can only be set on a connected socket.
+// net.Conn enables TCP_NODELAY on every new connection.
+func (o *TCPOptions) wrap(dial DialFunc) DialFunc {
+	if o.NoDelay && o.Linger < 0 {
+		return dial
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if !o.NoDelay {
+				err = tcpConn.SetNoDelay(false)
+			}
+			if err == nil && o.Linger >= 0 {
+				err = tcpConn.SetLinger(o.Linger)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+}
+
+func (o *TCPOptions) String() string {
+	options := []string{fmt.Sprintf("nodelay=%t", o.NoDelay)}
+
+	if o.Linger >= 0 {
+		options = append(options, fmt.Sprintf("linger=%ds", o.Linger))
+	} else {
+		options = append(options, "linger=default")
+	}
+
+	switch {
+	case o.KeepAlive < 0:
+		options = append(options, "keepalive=off")
+	case o.KeepAlive == 0:
+		options = append(options, "keepalive=default")
+	default:
+		options = append(options, "keepalive="+o.KeepAlive.String())
+	}
+
+	options = append(options, "sndbuf="+byteSizeOrDefault(o.SendBuffer), "rcvbuf="+byteSizeOrDefault(o.ReceiveBuffer))
+
+	if o.ConnectTimeout > 0 {
+		options = append(options, "connect-timeout="+o.ConnectTimeout.String())
+	} else {
+		options = append(options, "connect-timeout=none")
+	}
+	return strings.Join(options, " ")
+}
+
+func byteSizeOrDefault(n int) string {
+	if n > 0 {
+		return fmt.Sprint(n)
+	}
+	return "default"
+}
@@ -0,0 +1,19 @@
+package gb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTCPOptionsString(t *testing.T) {
+	expected := "nodelay=true linger=default keepalive=default sndbuf=default rcvbuf=default connect-timeout=none"
+	if actual := DefaultTCPOptions().String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	options := &TCPOptions{Linger: 0, KeepAlive: -1, SendBuffer: 65536, ConnectTimeout: 3 * time.Second}
+	expected = "nodelay=false linger=0s keepalive=off sndbuf=65536 rcvbuf=default connect-timeout=3s"
+	if actual := options.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
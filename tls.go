@@ -0,0 +1,144 @@
+package gb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	FieldTLSState = "TLSState"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+type TLSOptions struct {
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	ServerName string
+	MinVersion string
+	MaxVersion string
+	Ciphers    string
+	Verify     bool
+}
+
+// NewTLSConfig builds the client TLS configuration. Certificates are only
+// verified when a CA bundle is given or verification is asked for.
+func NewTLSConfig(options *TLSOptions) (tlsconfig *tls.Config, err error) {
+	tlsconfig = &tls.Config{
+		InsecureSkipVerify: !options.Verify && options.CAFile == "",
+		ServerName:         options.ServerName,
+	}
+
+	if options.CertFile != "" {
+		keyFile := options.KeyFile
+		if keyFile == "" {
+			keyFile = options.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(options.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %s", err)
+		}
+		tlsconfig.Certificates = []tls.Certificate{cert}
+	} else if options.KeyFile != "" {
+		return nil, errors.New("client key requires a client certificate")
+	}
+
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsconfig.RootCAs = x509.NewCertPool()
+		if !tlsconfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA bundle " + options.CAFile)
+		}
+	}
+
+	if tlsconfig.MinVersion, err = parseTLSVersion(options.MinVersion); err != nil {
+		return
+	}
+	if tlsconfig.MaxVersion, err = parseTLSVersion(options.MaxVersion); err != nil {
+		return
+	}
+	if tlsconfig.MinVersion != 0 && tlsconfig.MaxVersion != 0 && tlsconfig.MinVersion > tlsconfig.MaxVersion {
+		return nil, errors.New("minimum TLS version is greater than maximum TLS version")
+	}
+
+	if tlsconfig.CipherSuites, err = parseCipherSuites(options.Ciphers); err != nil {
+		return
+	}
+
+	return
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	if v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]; ok {
+		return v, nil
+	}
+	return 0, errors.New("unsupported TLS version: " + version)
+}
+
+// parseCipherSuites parses a comma separated list of cipher suite names, eg.
+// 'TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256'. TLS 1.3 suites are not configurable.
+func parseCipherSuites(names string) (ids []uint16, err error) {
+	if names == "" {
+		return
+	}
+
+	suites := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite.ID
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := suites[name]
+		if !ok {
+			return nil, errors.New("unknown cipher suite: " + name)
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// newClientTLSConfig returns a copy of the configured TLS configuration, which
+// skips certification check for self-signed certificates by default.
+func newClientTLSConfig(config *Config) *tls.Config {
+	if config.tlsConfig == nil {
+		return &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	return config.tlsConfig.Clone()
+}
+
+func printTLSState(buffer *bytes.Buffer, state *tls.ConnectionState) {
+	fmt.Fprintf(buffer, "TLS Protocol:           %s\n", tls.VersionName(state.Version))
+	fmt.Fprintf(buffer, "TLS Cipher:             %s\n", tls.CipherSuiteName(state.CipherSuite))
+	if state.ServerName != "" {
+		fmt.Fprintf(buffer, "TLS Server Name:        %s\n", state.ServerName)
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		fmt.Fprintf(buffer, "Certificate Subject:    %s\n", cert.Subject)
+		fmt.Fprintf(buffer, "Certificate Expiry:     %s (%d days left)\n",
+			cert.NotAfter.UTC().Format(time.RFC3339), int(cert.NotAfter.Sub(time.Now()).Hours()/24))
+	}
+	fmt.Fprint(buffer, "\n")
+}
@@ -0,0 +1,180 @@
+package gb
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+func newTestCert(t *testing.T, dir string, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate failed: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	c := &testCert{cert, key, filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")}
+	ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return c
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	testData := map[string]uint16{
+		"":       0,
+		"1.2":    tls.VersionTLS12,
+		"TLS1.3": tls.VersionTLS13,
+	}
+
+	for testingData, expectedData := range testData {
+		if version, err := parseTLSVersion(testingData); err != nil || version != expectedData {
+			t.Errorf("expected %x, got %x (%v)", expectedData, version, err)
+		}
+	}
+
+	if _, err := parseTLSVersion("2.0"); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	if err != nil {
+		t.Fatalf("parse cipher suites failed: %s", err)
+	}
+
+	if len(ids) != 2 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || ids[1] != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Fatalf("unexpected cipher suites %v", ids)
+	}
+
+	if _, err := parseCipherSuites("TLS_NOT_A_CIPHER"); err == nil {
+		t.Error("expected error for unknown cipher suite")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tlsconfig, err := NewTLSConfig(&TLSOptions{})
+	if err != nil || !tlsconfig.InsecureSkipVerify {
+		t.Fatalf("expected certification check to be skipped by default")
+	}
+
+	tlsconfig, err = NewTLSConfig(&TLSOptions{Verify: true, ServerName: "example.com", MinVersion: "1.2", MaxVersion: "1.3"})
+	if err != nil {
+		t.Fatalf("new tls config failed: %s", err)
+	}
+	if tlsconfig.InsecureSkipVerify || tlsconfig.ServerName != "example.com" ||
+		tlsconfig.MinVersion != tls.VersionTLS12 || tlsconfig.MaxVersion != tls.VersionTLS13 {
+		t.Fatalf("unexpected tls config %#+v", tlsconfig)
+	}
+
+	if _, err := NewTLSConfig(&TLSOptions{MinVersion: "1.3", MaxVersion: "1.2"}); err == nil {
+		t.Error("expected error for inverted version range")
+	}
+}
+
+func TestDetectHostWithMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gbtest")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, dir, "gbtest-ca", nil)
+	server := newTestCert(t, dir, "gbtest-server", ca)
+	client := newTestCert(t, dir, "gbtest-client", ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	serverCert, _ := tls.LoadX509KeyPair(server.certFile, server.keyFile)
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	config := &Config{
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+
+	// without client certificate
+	if config.tlsConfig, err = NewTLSConfig(&TLSOptions{CAFile: ca.certFile}); err != nil {
+		t.Fatalf("new tls config failed: %s", err)
+	}
+	if err := DetectHost(NewContext(config)); err == nil {
+		t.Fatal("expected handshake failure without client certificate")
+	}
+
+	// with client certificate
+	if config.tlsConfig, err = NewTLSConfig(&TLSOptions{CAFile: ca.certFile, CertFile: client.certFile, KeyFile: client.keyFile}); err != nil {
+		t.Fatalf("new tls config failed: %s", err)
+	}
+	context := NewContext(config)
+	if err := DetectHost(context); err != nil {
+		t.Fatalf("detect host failed: %s", err)
+	}
+
+	state, ok := context.GetValue(FieldTLSState).(*tls.ConnectionState)
+	if !ok || len(state.PeerCertificates) == 0 || state.PeerCertificates[0].Subject.CommonName != "gbtest-server" {
+		t.Fatal("expected negotiated TLS state of gbtest-server")
+	}
+
+	var buffer bytes.Buffer
+	printTLSState(&buffer, state)
+	if report := buffer.String(); !strings.Contains(report, "TLS Protocol:           TLS 1.3") || !strings.Contains(report, "CN=gbtest-server") {
+		t.Fatalf("unexpected TLS report:\n%s", report)
+	}
+}
@@ -0,0 +1,92 @@
+package gb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// TimeUnit is the unit durations are reported in. AutoTimeUnit picks µs, ms
+// or s by the median response time of the run.
+type TimeUnit time.Duration
+
+const (
+	AutoTimeUnit        TimeUnit = 0
+	MicrosecondTimeUnit          = TimeUnit(time.Microsecond)
+	MillisecondTimeUnit          = TimeUnit(time.Millisecond)
+	SecondTimeUnit               = TimeUnit(time.Second)
+)
+
+func ParseTimeUnit(s string) (TimeUnit, error) {
+	switch s {
+	case "", "auto":
+		return AutoTimeUnit, nil
+	case "us", "µs":
+		return MicrosecondTimeUnit, nil
+	case "ms":
+		return MillisecondTimeUnit, nil
+	case "s":
+		return SecondTimeUnit, nil
+	}
+	return 0, errors.New("invalid time unit: " + s + ", expected auto, us, ms or s")
+}
+
+// autoTimeUnit is the largest unit d is at least one of.
+func autoTimeUnit(d time.Duration) TimeUnit {
+	switch {
+	case d < time.Millisecond:
+		return MicrosecondTimeUnit
+	case d < time.Second:
+		return MillisecondTimeUnit
+	default:
+		return SecondTimeUnit
+	}
+}
+
+// resolve returns the unit of a report of responseTimes, ms if there are no
+// response times to pick from.
+func (u TimeUnit) resolve(responseTimes *Histogram) TimeUnit {
+	if u != AutoTimeUnit {
+		return u
+	}
+	if responseTimes == nil || responseTimes.TotalCount() == 0 {
+		return MillisecondTimeUnit
+	}
+	return autoTimeUnit(responseTimes.Percentile(50))
+}
+
+func (u TimeUnit) String() string {
+	switch u {
+	case AutoTimeUnit:
+		return "auto"
+	case MicrosecondTimeUnit:
+		return "µs"
+	case SecondTimeUnit:
+		return "s"
+	}
+	return "ms"
+}
+
+// Value converts d to the unit, AutoTimeUnit picks the unit of d.
+func (u TimeUnit) Value(d time.Duration) float64 {
+	if u == AutoTimeUnit {
+		u = autoTimeUnit(d)
+	}
+	return float64(d) / float64(u)
+}
+
+// Format formats d in the unit with microsecond precision, without the unit.
+func (u TimeUnit) Format(d time.Duration) string {
+	if u == AutoTimeUnit {
+		u = autoTimeUnit(d)
+	}
+	precision := 3
+	switch u {
+	case MicrosecondTimeUnit:
+		precision = 1
+	case SecondTimeUnit:
+		precision = 6
+	}
+	return strconv.FormatFloat(u.Value(d), 'f', precision, 64)
+}
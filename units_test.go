@@ -0,0 +1,54 @@
+package gb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeUnit(t *testing.T) {
+	for s, expected := range map[string]TimeUnit{"auto": AutoTimeUnit, "us": MicrosecondTimeUnit, "µs": MicrosecondTimeUnit, "ms": MillisecondTimeUnit, "s": SecondTimeUnit} {
+		if unit, err := ParseTimeUnit(s); err != nil || unit != expected {
+			t.Errorf("expected %s of %q, got %s (%v)", expected, s, unit, err)
+		}
+	}
+	if _, err := ParseTimeUnit("ns"); err == nil {
+		t.Error("expected an error of an unknown unit")
+	}
+}
+
+func TestTimeUnitFormat(t *testing.T) {
+	testData := []struct {
+		unit     TimeUnit
+		d        time.Duration
+		expected string
+	}{
+		{AutoTimeUnit, 850 * time.Microsecond, "850.0"},
+		{AutoTimeUnit, 1234567 * time.Nanosecond, "1.235"},
+		{AutoTimeUnit, 2500 * time.Millisecond, "2.500000"},
+		{MillisecondTimeUnit, 850 * time.Microsecond, "0.850"},
+		{MicrosecondTimeUnit, 2 * time.Second, "2000000.0"},
+		{SecondTimeUnit, 1500 * time.Microsecond, "0.001500"},
+	}
+	for _, data := range testData {
+		if actual := data.unit.Format(data.d); actual != data.expected {
+			t.Errorf("expected %s of %s in %s, got %s", data.expected, data.d, data.unit, actual)
+		}
+	}
+}
+
+func TestTimeUnitResolve(t *testing.T) {
+	h := newResponseTimeHistogram()
+	if unit := AutoTimeUnit.resolve(h); unit != MillisecondTimeUnit {
+		t.Fatalf("expected ms without response times, got %s", unit)
+	}
+
+	h.Record(100 * time.Microsecond)
+	h.Record(200 * time.Microsecond)
+	h.Record(3 * time.Second)
+	if unit := AutoTimeUnit.resolve(h); unit != MicrosecondTimeUnit {
+		t.Fatalf("expected µs of a median of 200µs, got %s", unit)
+	}
+	if unit := SecondTimeUnit.resolve(h); unit != SecondTimeUnit {
+		t.Fatalf("expected the fixed unit, got %s", unit)
+	}
+}